@@ -0,0 +1,315 @@
+package api_based
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/retry"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const AmplitudeBulkerTypeId = "amplitude"
+const AmplitudeUnsupported = "Only 'batch' mode is supported"
+
+// amplitudeMaxEventsPerRequest and amplitudeMaxBytesPerRequest are Amplitude's documented
+// /batch limits: https://amplitude.com/docs/apis/analytics/batch-event-upload
+const amplitudeMaxEventsPerRequest = 2000
+const amplitudeMaxBytesPerRequest = 1024 * 1024
+
+// amplitudeMaxThrottleRetries bounds how many times sendChunk re-sends a device-throttled subset
+// of a chunk before giving up, backing off amplitudeThrottleInitialDelay*2^attempt between tries.
+const amplitudeMaxThrottleRetries = 5
+const amplitudeThrottleInitialDelay = 500 * time.Millisecond
+const amplitudeThrottleMaxDelay = 10 * time.Second
+
+// amplitudeRetryPolicy additionally retries on 429, honoring Amplitude's Retry-After header when
+// present - except when the 429 body names specific throttled_devices, in which case RetryOn
+// returns false so sendChunk can retry just those devices' events instead of blanket-retrying (and
+// thereby delaying) the whole chunk.
+var amplitudeRetryPolicy = func() retry.RetryPolicy {
+	p := retry.DefaultRetryPolicy()
+	p.RetryOn = func(status int, body string) bool {
+		if status == 429 {
+			return len(amplitudeThrottledDeviceIds([]byte(body))) == 0
+		}
+		return status == 500 || status == 502 || status == 503
+	}
+	return p
+}()
+
+func init() {
+	bulker.RegisterBulker(AmplitudeBulkerTypeId, NewAmplitudeBulker)
+}
+
+type AmplitudeConfig struct {
+	ApiKey string `mapstructure:"apiKey" json:"apiKey" yaml:"apiKey"`
+}
+
+type AmplitudeBulker struct {
+	appbase.Service
+	config     AmplitudeConfig
+	httpClient *http.Client
+
+	closed *atomic.Bool
+}
+
+func NewAmplitudeBulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	amplitudeConfig := AmplitudeConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, &amplitudeConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	httpClient := &http.Client{
+		Timeout: time.Duration(5) * time.Second,
+	}
+	return &AmplitudeBulker{Service: appbase.NewServiceBase(AmplitudeBulkerTypeId), config: amplitudeConfig, httpClient: httpClient,
+		closed: &atomic.Bool{}}, nil
+}
+
+func (ap *AmplitudeBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	switch mode {
+	case bulker.Stream:
+		return nil, errors.New(AmplitudeUnsupported)
+	case bulker.Batch:
+		return NewTransactionalStream(id, ap, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return nil, errors.New(AmplitudeUnsupported)
+	case bulker.ReplacePartition:
+		return nil, errors.New(AmplitudeUnsupported)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+func (ap *AmplitudeBulker) Type() string {
+	return AmplitudeBulkerTypeId
+}
+
+// Upload chunks the NDJSON body into Amplitude's {api_key, events:[...]} envelope, honoring the
+// 2000-events/1MB-per-request limits, and POSTs each chunk to /batch. The spool file is gzipped
+// (GetBatchFileCompression), but events still need to be counted/split individually, so it's
+// ungzipped here before chunking and each chunk is sent as plain JSON.
+func (ap *AmplitudeBulker) Upload(reader io.Reader, eventsName string, _ int, _ map[string]any) (statusCode int, respBody string, err error) {
+	if ap.closed.Load() {
+		return 0, "", fmt.Errorf("attempt to use closed Amplitude instance")
+	}
+
+	gzReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to ungzip request body: %v", err)
+	}
+	defer gzReader.Close()
+
+	body, err := io.ReadAll(gzReader)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read request body: %v", err)
+	}
+
+	chunks, err := ap.chunkEvents(body)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for _, chunk := range chunks {
+		statusCode, respBody, err = ap.sendChunk(chunk)
+		if err != nil || (statusCode != 200 && statusCode != 202) {
+			return statusCode, respBody, err
+		}
+	}
+	return statusCode, respBody, nil
+}
+
+// chunkEvents splits NDJSON into event groups of at most amplitudeMaxEventsPerRequest events each,
+// where the group's *marshaled envelope* (see amplitudeEnvelope) - not just the sum of the raw
+// event bytes - stays within amplitudeMaxBytesPerRequest, since the envelope's "api_key"/"events"
+// wrapper and the commas between events also count against Amplitude's per-request byte limit.
+func (ap *AmplitudeBulker) chunkEvents(ndjson []byte) ([][]json.RawMessage, error) {
+	emptyEnvelope, err := amplitudeEnvelope(ap.config.ApiKey, []json.RawMessage{})
+	if err != nil {
+		return nil, err
+	}
+	envelopeOverhead := len(emptyEnvelope)
+
+	var chunks [][]json.RawMessage
+	var current []json.RawMessage
+	currentSize := envelopeOverhead
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		chunks = append(chunks, current)
+		current = nil
+		currentSize = envelopeOverhead
+	}
+
+	lines := bytes.Split(ndjson, []byte("\n"))
+	for _, line := range lines {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		//+1 for the comma joining this event to the previous one, if any
+		size := len(line)
+		if len(current) > 0 {
+			size++
+		}
+		if len(current) >= amplitudeMaxEventsPerRequest || currentSize+size > amplitudeMaxBytesPerRequest {
+			flush()
+			size = len(line)
+		}
+		current = append(current, json.RawMessage(line))
+		currentSize += size
+	}
+	flush()
+	return chunks, nil
+}
+
+// amplitudeEnvelope marshals events into Amplitude's {api_key, events:[...]} /batch request body.
+// Marshal validates each json.RawMessage, so this can fail if the spool file contains a malformed
+// NDJSON line - nothing upstream of chunkEvents validates lines - and that must surface as an
+// error rather than panic and take down the whole Upload call.
+func amplitudeEnvelope(apiKey string, events []json.RawMessage) ([]byte, error) {
+	b, err := json.Marshal(map[string]any{"api_key": apiKey, "events": events})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal amplitude envelope: %v", err)
+	}
+	return b, nil
+}
+
+// amplitudeThrottleResponse is the body Amplitude's /batch returns on a 429, naming which devices
+// triggered the rate limit: https://amplitude.com/docs/apis/analytics/batch-event-upload#errors
+type amplitudeThrottleResponse struct {
+	ThrottledDevices map[string]any `json:"throttled_devices,omitempty"`
+}
+
+// amplitudeThrottledDeviceIds extracts the device ids named in a 429 response body's
+// throttled_devices map, or nil if the body doesn't carry one (e.g. a blanket per-key rate limit).
+func amplitudeThrottledDeviceIds(respBody []byte) []string {
+	var parsed amplitudeThrottleResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil || len(parsed.ThrottledDevices) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(parsed.ThrottledDevices))
+	for id := range parsed.ThrottledDevices {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// splitAmplitudeEventsByDevice partitions events into those whose "device_id" is not in
+// throttledDeviceIds (unthrottled, safe to resend immediately) and those that are (throttled, which
+// must wait out the rate limit). Events without a device_id are treated as unthrottled, since they
+// can't be the ones a per-device throttle is naming.
+func splitAmplitudeEventsByDevice(events []json.RawMessage, throttledDeviceIds []string) (unthrottled, throttled []json.RawMessage) {
+	throttledSet := make(map[string]struct{}, len(throttledDeviceIds))
+	for _, id := range throttledDeviceIds {
+		throttledSet[id] = struct{}{}
+	}
+	for _, event := range events {
+		var parsed struct {
+			DeviceId string `json:"device_id"`
+		}
+		if err := json.Unmarshal(event, &parsed); err == nil {
+			if _, ok := throttledSet[parsed.DeviceId]; ok {
+				throttled = append(throttled, event)
+				continue
+			}
+		}
+		unthrottled = append(unthrottled, event)
+	}
+	return unthrottled, throttled
+}
+
+// sendChunk posts events to Amplitude's /batch, retrying transient failures via amplitudeRetryPolicy.
+// When the response is a 429 naming specific throttled_devices, only that subset's events are
+// retried (backing off between attempts, up to amplitudeMaxThrottleRetries) - events from devices
+// not named are resent immediately via a recursive sendChunk instead of waiting out devices they
+// have nothing to do with. A 429 without a throttled_devices list falls back to the blanket retry
+// amplitudeRetryPolicy already performs. The per-device split and retry happen only when the chunk
+// holds events of both kinds: a 429 whose throttled_devices cover all of the chunk's events, or none
+// of them, is returned as an error without a further retry.
+func (ap *AmplitudeBulker) sendChunk(events []json.RawMessage) (statusCode int, respBody string, err error) {
+	body, err := amplitudeEnvelope(ap.config.ApiKey, events)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var bodyBytes []byte
+	statusCode, bodyBytes, err = amplitudeRetryPolicy.Do(context.Background(), func() (*http.Response, error) {
+		req, reqErr := http.NewRequest("POST", "https://api2.amplitude.com/batch", bytes.NewReader(body))
+		if reqErr != nil {
+			return nil, reqErr
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		return ap.httpClient.Do(req)
+	})
+	respBody = string(bodyBytes)
+	if err != nil {
+		return statusCode, respBody, err
+	}
+
+	switch statusCode {
+	case 200, 202:
+		return statusCode, respBody, nil
+	case 429:
+		if throttledIds := amplitudeThrottledDeviceIds(bodyBytes); len(throttledIds) > 0 {
+			if unthrottled, throttled := splitAmplitudeEventsByDevice(events, throttledIds); len(unthrottled) > 0 && len(throttled) > 0 {
+				ap.Warnf("amplitude throttled device(s) %v: resending %d other event(s) immediately, retrying their %d event(s) separately", throttledIds, len(unthrottled), len(throttled))
+				clearStatus, clearBody, clearErr := ap.sendChunk(unthrottled)
+				if clearErr != nil || (clearStatus != 200 && clearStatus != 202) {
+					return clearStatus, clearBody, clearErr
+				}
+				return ap.retryThrottledChunk(throttled)
+			}
+		}
+		return statusCode, respBody, ap.NewError("http status: %v", statusCode)
+	default:
+		return statusCode, respBody, ap.NewError("http status: %v", statusCode)
+	}
+}
+
+// retryThrottledChunk re-sends a device-throttled subset of a chunk, backing off
+// amplitudeThrottleInitialDelay*2^attempt (capped at amplitudeThrottleMaxDelay) between tries.
+func (ap *AmplitudeBulker) retryThrottledChunk(events []json.RawMessage) (statusCode int, respBody string, err error) {
+	delay := amplitudeThrottleInitialDelay
+	for attempt := 0; attempt < amplitudeMaxThrottleRetries; attempt++ {
+		time.Sleep(delay)
+		statusCode, respBody, err = ap.sendChunk(events)
+		//sendChunk returns a 429 together with a non-nil error, so only a non-429 status ends the loop early
+		if statusCode != 429 {
+			return statusCode, respBody, err
+		}
+		delay *= 2
+		if delay > amplitudeThrottleMaxDelay {
+			delay = amplitudeThrottleMaxDelay
+		}
+	}
+	return statusCode, respBody, ap.NewError("amplitude: %d event(s) still throttled after %d retries", len(events), amplitudeMaxThrottleRetries)
+}
+
+func (ap *AmplitudeBulker) GetBatchFileFormat() types2.FileFormat {
+	return types2.FileFormatNDJSON
+}
+func (ap *AmplitudeBulker) GetBatchFileCompression() types2.FileCompression {
+	return types2.FileCompressionGZIP
+}
+
+func (ap *AmplitudeBulker) InmemoryBatch() bool {
+	return true
+}
+
+func (ap *AmplitudeBulker) Close() error {
+	ap.closed.Store(true)
+	ap.httpClient.CloseIdleConnections()
+	return nil
+}
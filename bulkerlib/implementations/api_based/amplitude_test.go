@@ -0,0 +1,97 @@
+package api_based
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAmplitudeChunkEventsRespectsEnvelopeOverhead(t *testing.T) {
+	ap := &AmplitudeBulker{config: AmplitudeConfig{ApiKey: "test-api-key"}}
+
+	// One event just under amplitudeMaxBytesPerRequest on its own, so only the envelope overhead
+	// (api_key/events wrapper) can push the marshaled request over the limit.
+	event := `{"event_type":"x","device_id":"d1","padding":"` + strings.Repeat("a", amplitudeMaxBytesPerRequest-100) + `"}`
+	ndjson := event + "\n" + event + "\n"
+
+	chunks, err := ap.chunkEvents([]byte(ndjson))
+	if err != nil {
+		t.Fatalf("chunkEvents: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected each oversized event in its own chunk, got %d chunks", len(chunks))
+	}
+	for i, chunk := range chunks {
+		body, err := amplitudeEnvelope(ap.config.ApiKey, chunk)
+		if err != nil {
+			t.Fatalf("amplitudeEnvelope: %v", err)
+		}
+		if len(body) > amplitudeMaxBytesPerRequest {
+			t.Fatalf("chunk %d marshaled envelope is %d bytes, exceeds amplitudeMaxBytesPerRequest", i, len(body))
+		}
+	}
+}
+
+func TestAmplitudeChunkEventsPacksManySmallEvents(t *testing.T) {
+	ap := &AmplitudeBulker{config: AmplitudeConfig{ApiKey: "k"}}
+	var sb strings.Builder
+	for i := 0; i < 3000; i++ {
+		sb.WriteString(`{"event_type":"x","device_id":"d1"}` + "\n")
+	}
+
+	chunks, err := ap.chunkEvents([]byte(sb.String()))
+	if err != nil {
+		t.Fatalf("chunkEvents: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("expected 3000 events to split into 2 chunks of <= %d, got %d chunks", amplitudeMaxEventsPerRequest, len(chunks))
+	}
+	total := 0
+	for _, chunk := range chunks {
+		if len(chunk) > amplitudeMaxEventsPerRequest {
+			t.Fatalf("chunk exceeds amplitudeMaxEventsPerRequest: %d", len(chunk))
+		}
+		total += len(chunk)
+	}
+	if total != 3000 {
+		t.Fatalf("expected 3000 total events across chunks, got %d", total)
+	}
+}
+
+func TestAmplitudeEnvelopeReturnsErrorOnMalformedEvent(t *testing.T) {
+	// json.Marshal validates every json.RawMessage it encodes, so a malformed line must surface as
+	// an error instead of panicking - nothing upstream validates NDJSON lines before this point.
+	malformed := []json.RawMessage{[]byte(`{not valid json`)}
+
+	if _, err := amplitudeEnvelope("k", malformed); err == nil {
+		t.Fatalf("expected an error for a malformed event, got nil")
+	}
+}
+
+func TestAmplitudeThrottledDeviceIds(t *testing.T) {
+	body := []byte(`{"code":429,"error":"too many requests","throttled_devices":{"dev-1":1,"dev-2":2}}`)
+	ids := amplitudeThrottledDeviceIds(body)
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 throttled device ids, got %v", ids)
+	}
+
+	if ids := amplitudeThrottledDeviceIds([]byte(`{"code":429,"error":"too many requests for this API key"}`)); len(ids) != 0 {
+		t.Fatalf("expected no throttled device ids, got %v", ids)
+	}
+}
+
+func TestSplitAmplitudeEventsByDevice(t *testing.T) {
+	events := []json.RawMessage{
+		[]byte(`{"event_type":"x","device_id":"dev-1"}`),
+		[]byte(`{"event_type":"x","device_id":"dev-2"}`),
+		[]byte(`{"event_type":"x","device_id":"dev-3"}`),
+	}
+
+	unthrottled, throttled := splitAmplitudeEventsByDevice(events, []string{"dev-2"})
+	if len(unthrottled) != 2 || len(throttled) != 1 {
+		t.Fatalf("expected 2 unthrottled and 1 throttled, got %d/%d", len(unthrottled), len(throttled))
+	}
+	if string(throttled[0]) != string(events[1]) {
+		t.Fatalf("expected dev-2's event to be throttled, got %q", throttled[0])
+	}
+}
@@ -0,0 +1,197 @@
+package api_based
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DeadLetterSink receives events a destination rejected, turning what would otherwise be silent
+// data loss into an auditable trail. reason is a human-readable rejection message (e.g. the
+// destination's per-record validation error) and destinationId identifies which bulker instance
+// produced it.
+type DeadLetterSink interface {
+	Write(ctx context.Context, rejected []byte, reason string, destinationId string) error
+}
+
+// deadLetterRecord is the envelope every sink implementation writes, so downstream tooling can
+// parse file/S3/webhook dead letters the same way regardless of sink.
+type deadLetterRecord struct {
+	DestinationId string          `json:"destinationId"`
+	Reason        string          `json:"reason"`
+	Timestamp     string          `json:"timestamp"`
+	Event         json.RawMessage `json:"event"`
+}
+
+func marshalDeadLetterRecord(rejected []byte, reason string, destinationId string) ([]byte, error) {
+	b, err := json.Marshal(deadLetterRecord{
+		DestinationId: destinationId,
+		Reason:        reason,
+		Timestamp:     time.Now().UTC().Format(time.RFC3339Nano),
+		Event:         json.RawMessage(rejected),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal dead letter record: %v", err)
+	}
+	return b, nil
+}
+
+// DeadLetterConfig selects and configures a DeadLetterSink for a destination. Exactly one of
+// File/S3/Webhook should be set; a nil DeadLetterConfig (or all-nil fields) disables dead-lettering.
+type DeadLetterConfig struct {
+	File    *FileDeadLetterConfig    `mapstructure:"file,omitempty" json:"file,omitempty" yaml:"file,omitempty"`
+	S3      *S3DeadLetterConfig      `mapstructure:"s3,omitempty" json:"s3,omitempty" yaml:"s3,omitempty"`
+	Webhook *WebhookDeadLetterConfig `mapstructure:"webhook,omitempty" json:"webhook,omitempty" yaml:"webhook,omitempty"`
+}
+
+// NewDeadLetterSink builds the sink configured by cfg, or returns (nil, nil) if cfg is nil or
+// names no backend - callers should treat a nil sink as "dead-lettering disabled".
+func NewDeadLetterSink(cfg *DeadLetterConfig) (DeadLetterSink, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	switch {
+	case cfg.File != nil:
+		return NewFileDeadLetterSink(*cfg.File)
+	case cfg.S3 != nil:
+		return NewS3DeadLetterSink(*cfg.S3)
+	case cfg.Webhook != nil:
+		return NewWebhookDeadLetterSink(*cfg.Webhook), nil
+	default:
+		return nil, nil
+	}
+}
+
+// FileDeadLetterConfig appends dead letters as NDJSON to a local file.
+type FileDeadLetterConfig struct {
+	Path string `mapstructure:"path" json:"path" yaml:"path"`
+}
+
+type fileDeadLetterSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileDeadLetterSink(cfg FileDeadLetterConfig) (DeadLetterSink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("dead letter file path is required")
+	}
+	if dir := filepath.Dir(cfg.Path); dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create dead letter directory: %v", err)
+		}
+	}
+	return &fileDeadLetterSink{path: cfg.Path}, nil
+}
+
+func (s *fileDeadLetterSink) Write(_ context.Context, rejected []byte, reason string, destinationId string) error {
+	b, err := marshalDeadLetterRecord(rejected, reason, destinationId)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open dead letter file: %v", err)
+	}
+	defer f.Close()
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter record: %v", err)
+	}
+	return nil
+}
+
+// S3DeadLetterConfig uploads each dead letter as its own object under Prefix/destinationId/....
+type S3DeadLetterConfig struct {
+	Bucket          string `mapstructure:"bucket" json:"bucket" yaml:"bucket"`
+	Region          string `mapstructure:"region,omitempty" json:"region,omitempty" yaml:"region,omitempty"`
+	AccessKeyID     string `mapstructure:"accessKeyId,omitempty" json:"accessKeyId,omitempty" yaml:"accessKeyId,omitempty"`
+	SecretAccessKey string `mapstructure:"secretAccessKey,omitempty" json:"secretAccessKey,omitempty" yaml:"secretAccessKey,omitempty"`
+	//Prefix is prepended to every object key, e.g. "dead-letters/".
+	Prefix string `mapstructure:"prefix,omitempty" json:"prefix,omitempty" yaml:"prefix,omitempty"`
+}
+
+type s3DeadLetterSink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewS3DeadLetterSink(cfg S3DeadLetterConfig) (DeadLetterSink, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("dead letter s3 bucket is required")
+	}
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(cfg.Region)}
+	if cfg.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aws config for dead letter sink: %v", err)
+	}
+	return &s3DeadLetterSink{client: s3.NewFromConfig(awsCfg), bucket: cfg.Bucket, prefix: cfg.Prefix}, nil
+}
+
+func (s *s3DeadLetterSink) Write(ctx context.Context, rejected []byte, reason string, destinationId string) error {
+	b, err := marshalDeadLetterRecord(rejected, reason, destinationId)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s%s/%s.json", s.prefix, destinationId, time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if _, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(b),
+	}); err != nil {
+		return fmt.Errorf("failed to put dead letter object: %v", err)
+	}
+	return nil
+}
+
+// WebhookDeadLetterConfig POSTs each dead letter as its own JSON request to Url.
+type WebhookDeadLetterConfig struct {
+	Url string `mapstructure:"url" json:"url" yaml:"url"`
+}
+
+type webhookDeadLetterSink struct {
+	url        string
+	httpClient *http.Client
+}
+
+func NewWebhookDeadLetterSink(cfg WebhookDeadLetterConfig) DeadLetterSink {
+	return &webhookDeadLetterSink{url: cfg.Url, httpClient: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (s *webhookDeadLetterSink) Write(ctx context.Context, rejected []byte, reason string, destinationId string) error {
+	b, err := marshalDeadLetterRecord(rejected, reason, destinationId)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post dead letter webhook: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("dead letter webhook returned status %d: %s", res.StatusCode, string(body))
+	}
+	return nil
+}
@@ -2,13 +2,17 @@ package api_based
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	bulker "github.com/jitsucom/bulker/bulkerlib"
 	types2 "github.com/jitsucom/bulker/bulkerlib/types"
 	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/retry"
 	"github.com/jitsucom/bulker/jitsubase/utils"
+	jsoniter "github.com/json-iterator/go"
 	"io"
 	"net/http"
 	"strings"
@@ -19,7 +23,9 @@ import (
 const MixpanelBulkerTypeId = "mixpanel"
 const MixpanelUnsupported = "Only 'batch' mode is supported"
 
-var retryDelaysMs = [5]int{100, 200, 200, 500, 0}
+const mixpanelImportUrl = "https://api.mixpanel.com/import?strict=1&project_id="
+const mixpanelEngageUrl = "https://api.mixpanel.com/engage"
+const mixpanelGroupsUrl = "https://api.mixpanel.com/groups"
 
 func init() {
 	bulker.RegisterBulker(MixpanelBulkerTypeId, NewMixpanelBulker)
@@ -29,11 +35,25 @@ type MixpanelConfig struct {
 	ProjectId              string `mapstructure:"projectId" json:"projectId" yaml:"projectId"`
 	ServiceAccountUserName string `mapstructure:"serviceAccountUserName" json:"serviceAccountUserName" yaml:"serviceAccountUserName"`
 	ServiceAccountPassword string `mapstructure:"serviceAccountPassword" json:"serviceAccountPassword" yaml:"serviceAccountPassword"`
+	//DisableEngageRouting keeps $identify/$set/$set_once/$unset events on /import instead of /engage.
+	DisableEngageRouting bool `mapstructure:"disableEngageRouting,omitempty" json:"disableEngageRouting,omitempty" yaml:"disableEngageRouting,omitempty"`
+	//DisableGroupsRouting keeps group-profile updates on /import instead of /groups.
+	DisableGroupsRouting bool `mapstructure:"disableGroupsRouting,omitempty" json:"disableGroupsRouting,omitempty" yaml:"disableGroupsRouting,omitempty"`
+	//DeadLetter configures where events rejected by Mixpanel's per-record validation are forwarded
+	//instead of being silently dropped. Unset disables dead-lettering.
+	DeadLetter *DeadLetterConfig `mapstructure:"deadLetter,omitempty" json:"deadLetter,omitempty" yaml:"deadLetter,omitempty"`
+	//Compression selects how the batch is held in memory/on disk before upload. Defaults to gzip.
+	//Mixpanel's API doesn't accept zstd, so sendImportBatch always re-encodes the wire body as gzip
+	//regardless of this setting - choosing zstd only shrinks the in-memory batch, which matters
+	//since InmemoryBatch() is true.
+	Compression types2.FileCompression `mapstructure:"compression,omitempty" json:"compression,omitempty" yaml:"compression,omitempty"`
 }
 type MixpanelBulker struct {
 	appbase.Service
-	config     MixpanelConfig
-	httpClient *http.Client
+	config        MixpanelConfig
+	httpClient    *http.Client
+	destinationId string
+	deadLetter    DeadLetterSink
 
 	closed *atomic.Bool
 }
@@ -43,11 +63,15 @@ func NewMixpanelBulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
 	if err := utils.ParseObject(bulkerConfig.DestinationConfig, &mixpanelConfig); err != nil {
 		return nil, fmt.Errorf("failed to parse destination config: %v", err)
 	}
+	deadLetter, err := NewDeadLetterSink(mixpanelConfig.DeadLetter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init dead letter sink: %v", err)
+	}
 	httpClient := &http.Client{
 		Timeout: time.Duration(5) * time.Second,
 	}
 	return &MixpanelBulker{Service: appbase.NewServiceBase(MixpanelBulkerTypeId), config: mixpanelConfig, httpClient: httpClient,
-		closed: &atomic.Bool{}}, nil
+		destinationId: bulkerConfig.Id, deadLetter: deadLetter, closed: &atomic.Bool{}}, nil
 }
 
 func (mp *MixpanelBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
@@ -68,71 +92,267 @@ func (mp *MixpanelBulker) Type() string {
 	return MixpanelBulkerTypeId
 }
 
+// Upload partitions the batch into up to three bodies - /import for regular analytics events
+// (gzipped NDJSON), /engage for $identify/$set/$set_once/$unset profile updates and /groups for
+// group-profile updates (both as a plain JSON array, per Mixpanel's profile-update API, not the
+// gzipped NDJSON /import framing) - and posts each with its own retry state, aggregating the
+// results into a single (statusCode, respBody, err). The spool file arrives compressed per
+// GetBatchFileCompression (gzip or zstd), so it's decompressed here to classify individual lines.
 func (mp *MixpanelBulker) Upload(reader io.Reader, eventsName string, _ int, _ map[string]any) (statusCode int, respBody string, err error) {
 	if mp.closed.Load() {
 		return 0, "", fmt.Errorf("attempt to use closed Mixpanel instance")
 	}
 
-	body, err := io.ReadAll(reader)
+	spoolReader, err := types2.NewDecompressReader(mp.compression(), reader)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open spool reader: %v", err)
+	}
+	defer spoolReader.Close()
+
+	body, err := io.ReadAll(spoolReader)
 	if err != nil {
 		return 0, "", fmt.Errorf("failed to read request body: %v", err)
 	}
-	for _, retryDelayMs := range retryDelaysMs {
-		var req *http.Request
-		//bytes reader
-		req, err = http.NewRequest("POST", "https://api.mixpanel.com/import?strict=1&project_id="+mp.config.ProjectId, bytes.NewReader(body))
-		if err != nil {
-			return 0, "", err
+
+	importLines, engageLines, groupsLines := mp.partitionEvents(body)
+
+	type result struct {
+		endpoint   string
+		statusCode int
+		respBody   string
+		err        error
+	}
+	var results []result
+	if len(importLines) > 0 {
+		sc, rb, e := mp.sendImportBatch(mixpanelImportUrl+mp.config.ProjectId, importLines)
+		results = append(results, result{"import", sc, rb, e})
+	}
+	if len(engageLines) > 0 {
+		sc, rb, e := mp.sendProfileBatch(mixpanelEngageUrl, engageLines)
+		results = append(results, result{"engage", sc, rb, e})
+	}
+	if len(groupsLines) > 0 {
+		sc, rb, e := mp.sendProfileBatch(mixpanelGroupsUrl, groupsLines)
+		results = append(results, result{"groups", sc, rb, e})
+	}
+
+	if len(results) == 0 {
+		return 200, "", nil
+	}
+
+	var respBodies []string
+	var errs []string
+	for _, r := range results {
+		respBodies = append(respBodies, fmt.Sprintf("%s: %s", r.endpoint, r.respBody))
+		if r.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", r.endpoint, r.err))
 		}
-		req.Header.Set("Content-Type", "application/x-ndjson")
-		req.Header.Set("Accept", "application/json")
-		req.Header.Set("Content-Encoding", "gzip")
-		serviceAccount := fmt.Sprintf("%s:%s", mp.config.ServiceAccountUserName, mp.config.ServiceAccountPassword)
-		req.Header.Set("Authorization", fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(serviceAccount))))
-
-		var res *http.Response
-		res, err = mp.httpClient.Do(req)
-		if err != nil {
-			statusCode = 0
-			respBody = ""
-			time.Sleep(time.Duration(retryDelayMs) * time.Millisecond)
+		//surface the worst (non-2xx, or highest) status code across the three calls
+		if r.statusCode > statusCode {
+			statusCode = r.statusCode
+		}
+	}
+	respBody = strings.Join(respBodies, "; ")
+	if len(errs) > 0 {
+		err = mp.NewError("%s", strings.Join(errs, "; "))
+	}
+	return statusCode, respBody, err
+}
+
+// partitionEvents splits NDJSON lines into /import, /engage and /groups buckets based on shape.
+// Engage updates carry one of the $identify/$set/$set_once/$unset operation keys; group-profile
+// updates additionally carry $group_key/$group_id. Group shape is checked first since a
+// group-profile update also satisfies isMixpanelEngageEvent ($set) - so with DisableGroupsRouting
+// set, a group event falls through to /import rather than being misrouted to /engage. Routing can
+// be disabled per-destination via config.
+func (mp *MixpanelBulker) partitionEvents(ndjson []byte) (importLines, engageLines, groupsLines [][]byte) {
+	for _, line := range bytes.Split(ndjson, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
 			continue
-		} else {
-			defer res.Body.Close()
-			var bodyBytes []byte
-			bodyBytes, err = io.ReadAll(res.Body)
-			respBody = string(bodyBytes)
-			statusCode = res.StatusCode
-			errText := ""
-			if err != nil {
-				errText = err.Error()
-			}
-			switch statusCode {
-			case 200:
-				return statusCode, respBody, nil
-			case 400:
-				if strings.Contains(respBody, "some data points in the request failed validation") {
-					return statusCode, respBody, nil
-				} else {
-					return statusCode, respBody, mp.NewError("http status: %v%s", statusCode, errText)
-				}
-			case 500, 502, 503:
-				err = mp.NewError("http status: %v%s", statusCode, errText)
-				time.Sleep(time.Duration(retryDelayMs) * time.Millisecond)
+		}
+
+		if isMixpanelGroupEvent(line) {
+			if !mp.config.DisableGroupsRouting {
+				groupsLines = append(groupsLines, line)
 				continue
-			default:
-				return statusCode, respBody, mp.NewError("http status: %v%s", statusCode, errText)
 			}
+		} else if !mp.config.DisableEngageRouting && isMixpanelEngageEvent(line) {
+			engageLines = append(engageLines, line)
+			continue
 		}
+		importLines = append(importLines, line)
 	}
 	return
 }
 
+func isMixpanelEngageEvent(line []byte) bool {
+	var obj map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(line, &obj); err != nil {
+		return false
+	}
+	for _, key := range []string{"$identify", "$set", "$set_once", "$unset"} {
+		if _, ok := obj[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isMixpanelGroupEvent(line []byte) bool {
+	var obj map[string]jsoniter.RawMessage
+	if err := jsoniter.Unmarshal(line, &obj); err != nil {
+		return false
+	}
+	_, hasGroupKey := obj["$group_key"]
+	_, hasGroupId := obj["$group_id"]
+	return hasGroupKey || hasGroupId
+}
+
+// mixpanelRetryPolicy retries on 429 (honoring Retry-After, which Mixpanel sends on throttling)
+// as well as the 500/502/503 the previous fixed retry table handled.
+var mixpanelRetryPolicy = func() retry.RetryPolicy {
+	p := retry.DefaultRetryPolicy()
+	p.RetryOn = func(status int, body string) bool {
+		if status == 400 {
+			//partial-validation failures aren't retryable - the good records already landed
+			return false
+		}
+		return status == 429 || status == 500 || status == 502 || status == 503
+	}
+	return p
+}()
+
+// sendImportBatch gzips lines as newline-delimited JSON and POSTs them to url (the /import
+// endpoint), retrying on transient failures via mixpanelRetryPolicy.
+func (mp *MixpanelBulker) sendImportBatch(url string, lines [][]byte) (statusCode int, respBody string, err error) {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	for _, line := range lines {
+		if _, err = gzWriter.Write(line); err != nil {
+			return 0, "", fmt.Errorf("failed to gzip mixpanel batch: %v", err)
+		}
+		if _, err = gzWriter.Write([]byte("\n")); err != nil {
+			return 0, "", fmt.Errorf("failed to gzip mixpanel batch: %v", err)
+		}
+	}
+	if err = gzWriter.Close(); err != nil {
+		return 0, "", fmt.Errorf("failed to gzip mixpanel batch: %v", err)
+	}
+
+	return mp.post(url, buf.Bytes(), "application/x-ndjson", "gzip", lines)
+}
+
+// sendProfileBatch POSTs lines (each an $identify/$set/$set_once/$unset or group-profile update
+// object) to url (/engage or /groups) as a plain JSON array, which is what those endpoints expect -
+// unlike /import they don't accept gzipped NDJSON import framing.
+func (mp *MixpanelBulker) sendProfileBatch(url string, lines [][]byte) (statusCode int, respBody string, err error) {
+	return mp.post(url, mixpanelJSONArray(lines), "application/json", "", lines)
+}
+
+// mixpanelJSONArray joins lines (each a JSON object) into a single JSON array literal without
+// re-parsing them.
+func mixpanelJSONArray(lines [][]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(line)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// post sends body to url via mixpanelRetryPolicy, setting contentEncoding (when non-"") and
+// basic-auth'ing with the configured service account. lines is the original, uncompressed set of
+// records in body, used to correlate a partial-validation 400 response back to the rejected records.
+func (mp *MixpanelBulker) post(url string, body []byte, contentType, contentEncoding string, lines [][]byte) (statusCode int, respBody string, err error) {
+	serviceAccount := fmt.Sprintf("%s:%s", mp.config.ServiceAccountUserName, mp.config.ServiceAccountPassword)
+	authHeader := fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(serviceAccount)))
+
+	var bodyBytes []byte
+	statusCode, bodyBytes, err = mixpanelRetryPolicy.Do(context.Background(), func() (*http.Response, error) {
+		req, reqErr := http.NewRequest("POST", url, bytes.NewReader(body))
+		if reqErr != nil {
+			return nil, reqErr
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", "application/json")
+		if contentEncoding != "" {
+			req.Header.Set("Content-Encoding", contentEncoding)
+		}
+		req.Header.Set("Authorization", authHeader)
+		return mp.httpClient.Do(req)
+	})
+	respBody = string(bodyBytes)
+	if err != nil {
+		return statusCode, respBody, err
+	}
+
+	switch {
+	case statusCode == 200:
+		return statusCode, respBody, nil
+	case statusCode == 400 && strings.Contains(respBody, "some data points in the request failed validation"):
+		mp.deadLetterFailedRecords(lines, bodyBytes)
+		return statusCode, respBody, nil
+	default:
+		return statusCode, respBody, mp.NewError("http status: %v", statusCode)
+	}
+}
+
+// mixpanelFailedRecord is one entry of a partial-validation 400 response's failed_records array.
+type mixpanelFailedRecord struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type mixpanelImportResponse struct {
+	FailedRecords []mixpanelFailedRecord `json:"failed_records"`
+}
+
+// deadLetterFailedRecords correlates a partial-validation response's failed_records (by index) back
+// to the original request lines and forwards each rejected line plus its error message to the
+// configured DeadLetterSink. Failures to parse or forward are logged, not returned, since the batch
+// itself already succeeded for its accepted records.
+func (mp *MixpanelBulker) deadLetterFailedRecords(lines [][]byte, respBody []byte) {
+	if mp.deadLetter == nil {
+		return
+	}
+	var parsed mixpanelImportResponse
+	if err := jsoniter.Unmarshal(respBody, &parsed); err != nil {
+		mp.Warnf("failed to parse mixpanel failed_records: %v", err)
+		return
+	}
+	for _, rec := range parsed.FailedRecords {
+		if rec.Index < 0 || rec.Index >= len(lines) {
+			continue
+		}
+		reason := rec.Message
+		if rec.Field != "" {
+			reason = fmt.Sprintf("%s: %s", rec.Field, reason)
+		}
+		if err := mp.deadLetter.Write(context.Background(), lines[rec.Index], reason, mp.destinationId); err != nil {
+			mp.Warnf("failed to write dead letter record: %v", err)
+		}
+	}
+}
+
 func (mp *MixpanelBulker) GetBatchFileFormat() types2.FileFormat {
 	return types2.FileFormatNDJSON
 }
 func (mp *MixpanelBulker) GetBatchFileCompression() types2.FileCompression {
-	return types2.FileCompressionGZIP
+	return mp.compression()
+}
+
+// compression resolves the configured spool-file compression, defaulting to gzip.
+func (mp *MixpanelBulker) compression() types2.FileCompression {
+	if mp.config.Compression == types2.FileCompressionNone {
+		return types2.FileCompressionGZIP
+	}
+	return mp.config.Compression
 }
 
 func (mp *MixpanelBulker) InmemoryBatch() bool {
@@ -0,0 +1,142 @@
+package api_based
+
+import (
+	"context"
+	"testing"
+)
+
+// fakeDeadLetterSink records every Write call for assertions, instead of forwarding anywhere.
+type fakeDeadLetterSink struct {
+	writes []fakeDeadLetterWrite
+}
+
+type fakeDeadLetterWrite struct {
+	rejected      string
+	reason        string
+	destinationId string
+}
+
+func (f *fakeDeadLetterSink) Write(_ context.Context, rejected []byte, reason string, destinationId string) error {
+	f.writes = append(f.writes, fakeDeadLetterWrite{string(rejected), reason, destinationId})
+	return nil
+}
+
+func TestMixpanelPartitionEvents(t *testing.T) {
+	mp := &MixpanelBulker{}
+	ndjson := []byte(
+		`{"event":"page_view","properties":{"distinct_id":"u1"}}` + "\n" +
+			`{"$identify":{"$anon_distinct_id":"a1","$identified_id":"u1"}}` + "\n" +
+			`{"$group_key":"company","$group_id":"acme","$set":{"plan":"pro"}}` + "\n")
+
+	importLines, engageLines, groupsLines := mp.partitionEvents(ndjson)
+
+	if len(importLines) != 1 || string(importLines[0]) != `{"event":"page_view","properties":{"distinct_id":"u1"}}` {
+		t.Fatalf("unexpected importLines: %q", importLines)
+	}
+	if len(engageLines) != 1 {
+		t.Fatalf("unexpected engageLines: %q", engageLines)
+	}
+	if len(groupsLines) != 1 {
+		t.Fatalf("unexpected groupsLines: %q", groupsLines)
+	}
+}
+
+func TestMixpanelPartitionEventsRoutingDisabled(t *testing.T) {
+	mp := &MixpanelBulker{config: MixpanelConfig{DisableEngageRouting: true}}
+	ndjson := []byte(`{"$identify":{"$anon_distinct_id":"a1","$identified_id":"u1"}}` + "\n")
+
+	importLines, engageLines, groupsLines := mp.partitionEvents(ndjson)
+
+	if len(importLines) != 1 {
+		t.Fatalf("expected $identify to stay on /import when DisableEngageRouting is set, got importLines=%q engageLines=%q", importLines, engageLines)
+	}
+	if len(engageLines) != 0 || len(groupsLines) != 0 {
+		t.Fatalf("expected no engage/groups lines, got engageLines=%q groupsLines=%q", engageLines, groupsLines)
+	}
+}
+
+func TestMixpanelPartitionEventsGroupsRoutingDisabled(t *testing.T) {
+	mp := &MixpanelBulker{config: MixpanelConfig{DisableGroupsRouting: true}}
+	ndjson := []byte(`{"$group_key":"company","$group_id":"acme","$set":{"plan":"pro"}}` + "\n")
+
+	importLines, engageLines, groupsLines := mp.partitionEvents(ndjson)
+
+	if len(importLines) != 1 {
+		t.Fatalf("expected group event to fall through to /import when DisableGroupsRouting is set, got importLines=%q", importLines)
+	}
+	if len(engageLines) != 0 || len(groupsLines) != 0 {
+		t.Fatalf("expected no engage/groups lines, got engageLines=%q groupsLines=%q", engageLines, groupsLines)
+	}
+}
+
+func TestMixpanelJSONArray(t *testing.T) {
+	lines := [][]byte{
+		[]byte(`{"$identify":{"$anon_distinct_id":"a1","$identified_id":"u1"}}`),
+		[]byte(`{"$group_key":"company","$group_id":"acme","$set":{"plan":"pro"}}`),
+	}
+
+	got := string(mixpanelJSONArray(lines))
+	want := `[{"$identify":{"$anon_distinct_id":"a1","$identified_id":"u1"}},{"$group_key":"company","$group_id":"acme","$set":{"plan":"pro"}}]`
+	if got != want {
+		t.Fatalf("mixpanelJSONArray() = %q, want %q", got, want)
+	}
+}
+
+func TestMixpanelJSONArrayEmpty(t *testing.T) {
+	if got := string(mixpanelJSONArray(nil)); got != "[]" {
+		t.Fatalf("mixpanelJSONArray(nil) = %q, want []", got)
+	}
+}
+
+func TestMixpanelDeadLetterFailedRecordsCorrelatesByIndex(t *testing.T) {
+	sink := &fakeDeadLetterSink{}
+	mp := &MixpanelBulker{deadLetter: sink, destinationId: "dest-1"}
+	lines := [][]byte{
+		[]byte(`{"event":"ok"}`),
+		[]byte(`{"event":"bad_distinct_id"}`),
+		[]byte(`{"event":"also_bad"}`),
+	}
+	respBody := []byte(`{"failed_records":[` +
+		`{"index":1,"field":"distinct_id","message":"missing"},` +
+		`{"index":2,"message":"malformed timestamp"}` +
+		`]}`)
+
+	mp.deadLetterFailedRecords(lines, respBody)
+
+	if len(sink.writes) != 2 {
+		t.Fatalf("expected 2 dead-lettered records, got %d: %+v", len(sink.writes), sink.writes)
+	}
+	if sink.writes[0].rejected != string(lines[1]) || sink.writes[0].reason != "distinct_id: missing" {
+		t.Fatalf("unexpected first dead letter: %+v", sink.writes[0])
+	}
+	if sink.writes[1].rejected != string(lines[2]) || sink.writes[1].reason != "malformed timestamp" {
+		t.Fatalf("unexpected second dead letter: %+v", sink.writes[1])
+	}
+	for _, w := range sink.writes {
+		if w.destinationId != "dest-1" {
+			t.Fatalf("expected destinationId to be forwarded, got %+v", w)
+		}
+	}
+}
+
+func TestMixpanelDeadLetterFailedRecordsIgnoresOutOfRangeIndex(t *testing.T) {
+	sink := &fakeDeadLetterSink{}
+	mp := &MixpanelBulker{deadLetter: sink}
+	lines := [][]byte{[]byte(`{"event":"ok"}`)}
+	respBody := []byte(`{"failed_records":[{"index":5,"message":"out of range"}]}`)
+
+	mp.deadLetterFailedRecords(lines, respBody)
+
+	if len(sink.writes) != 0 {
+		t.Fatalf("expected out-of-range index to be skipped, got %+v", sink.writes)
+	}
+}
+
+func TestMixpanelDeadLetterFailedRecordsNoopWithoutSink(t *testing.T) {
+	mp := &MixpanelBulker{}
+	lines := [][]byte{[]byte(`{"event":"bad"}`)}
+	respBody := []byte(`{"failed_records":[{"index":0,"message":"nope"}]}`)
+
+	// Should not panic when no DeadLetterSink is configured.
+	mp.deadLetterFailedRecords(lines, respBody)
+}
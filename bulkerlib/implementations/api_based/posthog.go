@@ -0,0 +1,153 @@
+package api_based
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	bulker "github.com/jitsucom/bulker/bulkerlib"
+	types2 "github.com/jitsucom/bulker/bulkerlib/types"
+	"github.com/jitsucom/bulker/jitsubase/appbase"
+	"github.com/jitsucom/bulker/jitsubase/retry"
+	"github.com/jitsucom/bulker/jitsubase/utils"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const PosthogBulkerTypeId = "posthog"
+const PosthogUnsupported = "Only 'batch' mode is supported"
+const posthogDefaultHost = "https://us.i.posthog.com"
+
+func init() {
+	bulker.RegisterBulker(PosthogBulkerTypeId, NewPosthogBulker)
+}
+
+type PosthogConfig struct {
+	ApiKey string `mapstructure:"apiKey" json:"apiKey" yaml:"apiKey"`
+	//Host defaults to https://us.i.posthog.com. Use https://eu.i.posthog.com for the EU cloud,
+	//or a self-hosted PostHog URL.
+	Host string `mapstructure:"host,omitempty" json:"host,omitempty" yaml:"host,omitempty"`
+}
+
+type PosthogBulker struct {
+	appbase.Service
+	config     PosthogConfig
+	httpClient *http.Client
+
+	closed *atomic.Bool
+}
+
+func NewPosthogBulker(bulkerConfig bulker.Config) (bulker.Bulker, error) {
+	posthogConfig := PosthogConfig{}
+	if err := utils.ParseObject(bulkerConfig.DestinationConfig, &posthogConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse destination config: %v", err)
+	}
+	posthogConfig.Host = strings.TrimSuffix(utils.NvlString(posthogConfig.Host, posthogDefaultHost), "/")
+	httpClient := &http.Client{
+		Timeout: time.Duration(5) * time.Second,
+	}
+	return &PosthogBulker{Service: appbase.NewServiceBase(PosthogBulkerTypeId), config: posthogConfig, httpClient: httpClient,
+		closed: &atomic.Bool{}}, nil
+}
+
+func (ph *PosthogBulker) CreateStream(id, tableName string, mode bulker.BulkMode, streamOptions ...bulker.StreamOption) (bulker.BulkerStream, error) {
+	switch mode {
+	case bulker.Stream:
+		return nil, errors.New(PosthogUnsupported)
+	case bulker.Batch:
+		return NewTransactionalStream(id, ph, tableName, streamOptions...)
+	case bulker.ReplaceTable:
+		return nil, errors.New(PosthogUnsupported)
+	case bulker.ReplacePartition:
+		return nil, errors.New(PosthogUnsupported)
+	}
+	return nil, fmt.Errorf("unsupported bulk mode: %s", mode)
+}
+
+func (ph *PosthogBulker) Type() string {
+	return PosthogBulkerTypeId
+}
+
+// Upload wraps the NDJSON batch into PostHog's {api_key, batch:[...]} envelope and posts it gzipped
+// to {host}/batch/. The spool file already arrives gzip-compressed (GetBatchFileCompression), so
+// it's ungzipped, re-enveloped as a single JSON object, then re-gzipped for the wire.
+func (ph *PosthogBulker) Upload(reader io.Reader, eventsName string, _ int, _ map[string]any) (statusCode int, respBody string, err error) {
+	if ph.closed.Load() {
+		return 0, "", fmt.Errorf("attempt to use closed Posthog instance")
+	}
+
+	gzReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to ungzip request body: %v", err)
+	}
+	defer gzReader.Close()
+
+	ndjson, err := io.ReadAll(gzReader)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read request body: %v", err)
+	}
+
+	var batch []json.RawMessage
+	for _, line := range bytes.Split(ndjson, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			batch = append(batch, json.RawMessage(line))
+		}
+	}
+	envelope, err := json.Marshal(map[string]any{"api_key": ph.config.ApiKey, "batch": batch})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to marshal posthog batch: %v", err)
+	}
+
+	var body bytes.Buffer
+	gzWriter := gzip.NewWriter(&body)
+	if _, err = gzWriter.Write(envelope); err != nil {
+		return 0, "", fmt.Errorf("failed to gzip posthog batch: %v", err)
+	}
+	if err = gzWriter.Close(); err != nil {
+		return 0, "", fmt.Errorf("failed to gzip posthog batch: %v", err)
+	}
+
+	bodyBytes := body.Bytes()
+	var respBodyBytes []byte
+	statusCode, respBodyBytes, err = retry.DefaultRetryPolicy().Do(context.Background(), func() (*http.Response, error) {
+		req, reqErr := http.NewRequest("POST", ph.config.Host+"/batch/", bytes.NewReader(bodyBytes))
+		if reqErr != nil {
+			return nil, reqErr
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		return ph.httpClient.Do(req)
+	})
+	respBody = string(respBodyBytes)
+	if err != nil {
+		return statusCode, respBody, err
+	}
+	if statusCode == 200 {
+		return statusCode, respBody, nil
+	}
+	return statusCode, respBody, ph.NewError("http status: %v", statusCode)
+}
+
+func (ph *PosthogBulker) GetBatchFileFormat() types2.FileFormat {
+	return types2.FileFormatNDJSON
+}
+func (ph *PosthogBulker) GetBatchFileCompression() types2.FileCompression {
+	return types2.FileCompressionGZIP
+}
+
+func (ph *PosthogBulker) InmemoryBatch() bool {
+	return true
+}
+
+func (ph *PosthogBulker) Close() error {
+	ph.closed.Store(true)
+	ph.httpClient.CloseIdleConnections()
+	return nil
+}
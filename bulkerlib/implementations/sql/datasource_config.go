@@ -11,6 +11,9 @@ type DataSourceConfig struct {
 	Username   string            `mapstructure:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
 	Password   string            `mapstructure:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
 	Parameters map[string]string `mapstructure:"parameters,omitempty" json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	//SSHTunnel, when set, routes the connection through an SSH bastion rather than reaching
+	//Host/Port directly - common in enterprise deployments where the warehouse isn't publicly reachable.
+	SSHTunnel *SSHTunnelConfig `mapstructure:"sshTunnel,omitempty" json:"sshTunnel,omitempty" yaml:"sshTunnel,omitempty"`
 }
 
 // Validate required fields in DataSourceConfig
@@ -23,5 +26,11 @@ func (dsc *DataSourceConfig) Validate() error {
 		dsc.Parameters = map[string]string{}
 	}
 
+	if dsc.SSHTunnel != nil {
+		if err := dsc.SSHTunnel.Validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
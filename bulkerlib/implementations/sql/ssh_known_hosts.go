@@ -0,0 +1,24 @@
+package sql
+
+import (
+	"errors"
+	"github.com/jitsucom/bulker/base/logging"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshHostKeyCallback builds a ssh.HostKeyCallback from knownHostsFile. Falling back to
+// ssh.InsecureIgnoreHostKey() when knownHostsFile is unset now requires insecureSkipHostKeyVerify
+// to be explicitly true - SSHTunnelConfig.Validate already enforces that one of the two is set, but
+// this function checks it again rather than trusting the caller, since an unverified bastion host
+// key accepts a MITM'd connection silently otherwise.
+func sshHostKeyCallback(knownHostsFile string, insecureSkipHostKeyVerify bool) (ssh.HostKeyCallback, error) {
+	if knownHostsFile != "" {
+		return knownhosts.New(knownHostsFile)
+	}
+	if !insecureSkipHostKeyVerify {
+		return nil, errors.New("sshTunnel.knownHostsFile is required unless sshTunnel.insecureSkipHostKeyVerify is set")
+	}
+	logging.Warnf("sshTunnel.insecureSkipHostKeyVerify is set: the SSH bastion host key will NOT be verified, leaving the tunnel open to man-in-the-middle attacks. Set sshTunnel.knownHostsFile to verify it.")
+	return ssh.InsecureIgnoreHostKey(), nil
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// FileFormat is the on-disk/on-wire encoding of a batch of events staged before upload.
+type FileFormat string
+
+const (
+	FileFormatNDJSON FileFormat = "ndjson"
+)
+
+// FileCompression is the compression applied to a staged batch file in addition to FileFormat.
+type FileCompression string
+
+const (
+	FileCompressionNone FileCompression = ""
+	FileCompressionGZIP FileCompression = "gzip"
+	//FileCompressionZSTD trades slower encode for a smaller spool file than gzip - useful for
+	//InmemoryBatch() destinations that hold the whole batch in memory before upload. Destinations
+	//whose API doesn't accept zstd on the wire (e.g. Mixpanel) re-encode to gzip before sending;
+	//this only changes how the batch is held before that point.
+	FileCompressionZSTD FileCompression = "zstd"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// NewCompressWriter wraps w so writes are compressed per compression. Callers must Close() the
+// returned writer to flush any trailing compressed data.
+func NewCompressWriter(compression FileCompression, w io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case FileCompressionNone:
+		return nopWriteCloser{w}, nil
+	case FileCompressionGZIP:
+		return gzip.NewWriter(w), nil
+	case FileCompressionZSTD:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported file compression: %s", compression)
+	}
+}
+
+// NewDecompressReader wraps r so reads are decompressed per compression, letting spool file
+// consumers read either encoding transparently without branching on it themselves.
+func NewDecompressReader(compression FileCompression, r io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case FileCompressionNone:
+		return io.NopCloser(r), nil
+	case FileCompressionGZIP:
+		return gzip.NewReader(r)
+	case FileCompressionZSTD:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported file compression: %s", compression)
+	}
+}
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// TestCompressRoundTrip guards against a writer/reader encoding mismatch: for every
+// FileCompression, whatever NewCompressWriter produces must be exactly what NewDecompressReader
+// expects to read back.
+func TestCompressRoundTrip(t *testing.T) {
+	for _, compression := range []FileCompression{FileCompressionNone, FileCompressionGZIP, FileCompressionZSTD} {
+		t.Run(string(compression)+"/empty", func(t *testing.T) {
+			assertRoundTrip(t, compression, nil)
+		})
+		t.Run(string(compression), func(t *testing.T) {
+			assertRoundTrip(t, compression, []byte(`{"event":"test"}`+"\n"+`{"event":"test2"}`+"\n"))
+		})
+	}
+}
+
+func assertRoundTrip(t *testing.T, compression FileCompression, want []byte) {
+	var buf bytes.Buffer
+	w, err := NewCompressWriter(compression, &buf)
+	if err != nil {
+		t.Fatalf("NewCompressWriter(%s): %v", compression, err)
+	}
+	if _, err := w.Write(want); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	r, err := NewDecompressReader(compression, &buf)
+	if err != nil {
+		t.Fatalf("NewDecompressReader(%s): %v", compression, err)
+	}
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("round trip mismatch: got %q, want %q", got, want)
+	}
+}
+
+func TestNewCompressWriterUnsupported(t *testing.T) {
+	if _, err := NewCompressWriter("lz4", &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for unsupported compression")
+	}
+}
+
+func TestNewDecompressReaderUnsupported(t *testing.T) {
+	if _, err := NewDecompressReader("lz4", &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error for unsupported compression")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/jitsucom/bulker/jitsubase/safego"
 	"github.com/jitsucom/bulker/jitsubase/utils"
 	"slices"
+	"strings"
 
 	"sync"
 	"time"
@@ -18,6 +19,10 @@ import (
 
 const chEventsLogServiceName = "ch_events_log"
 
+// chMaxScanRows bounds how many rows GetEvents/ReplayEvents will read from events_log in one call,
+// so a loose filter (or no filter) can't scan the whole table.
+const chMaxScanRows = 10000
+
 type ClickhouseEventsLog struct {
 	sync.Mutex
 	appbase.Service
@@ -140,8 +145,122 @@ func (r *ClickhouseEventsLog) PostEvent(event *ActorEvent) (id EventsLogRecordId
 	return
 }
 
+// GetEvents returns up to limit events_log rows matching eventType/actorId/level/filter, ordered by
+// (timestamp, actorId) ascending starting right after filter.AfterTimestamp/AfterActorId (keyset
+// pagination - cheaper than OFFSET on a large ClickHouse table). limit is capped at chMaxScanRows.
 func (r *ClickhouseEventsLog) GetEvents(eventType EventType, actorId string, level string, filter *EventsLogFilter, limit int) ([]EventsLogRecord, error) {
-	return nil, fmt.Errorf("not implemented")
+	if limit <= 0 || limit > chMaxScanRows {
+		limit = chMaxScanRows
+	}
+
+	where, args := r.buildEventsLogWhere(eventType, actorId, level, filter)
+
+	query := fmt.Sprintf(`SELECT timestamp, actorId, type, level, data FROM events_log FINAL
+		WHERE %s ORDER BY timestamp, actorId LIMIT ?`, where)
+	args = append(args, limit)
+
+	rows, err := r.conn.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events_log: %v", err)
+	}
+	defer rows.Close()
+
+	var records []EventsLogRecord
+	for rows.Next() {
+		var ts time.Time
+		var recActorId, recType, recLevel, data string
+		if err := rows.Scan(&ts, &recActorId, &recType, &recLevel, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan events_log row: %v", err)
+		}
+		records = append(records, EventsLogRecord{
+			Timestamp: ts,
+			ActorId:   recActorId,
+			EventType: EventType(recType),
+			Level:     recLevel,
+			Content:   data,
+		})
+	}
+	return records, rows.Err()
+}
+
+// ReplayEvents streams events_log rows matching filter back through sink, in the same
+// (timestamp, actorId) order GetEvents uses, so failed events can be reprocessed after a
+// destination outage. It stops on the first sink error.
+func (r *ClickhouseEventsLog) ReplayEvents(ctx context.Context, filter *EventsLogFilter, sink func(*ActorEvent) error) error {
+	where, args := r.buildEventsLogWhere("", "", "", filter)
+
+	query := fmt.Sprintf(`SELECT timestamp, actorId, type, level, data FROM events_log FINAL
+		WHERE %s ORDER BY timestamp, actorId LIMIT ?`, where)
+	args = append(args, chMaxScanRows)
+
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query events_log for replay: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		var ts time.Time
+		var actorId, eventType, level, data string
+		if err := rows.Scan(&ts, &actorId, &eventType, &level, &data); err != nil {
+			return fmt.Errorf("failed to scan events_log row: %v", err)
+		}
+		var event any
+		if err := jsonorder.Unmarshal([]byte(data), &event); err != nil {
+			r.Errorf("skipping unparsable events_log row for actor %s: %v", actorId, err)
+			continue
+		}
+		if err := sink(&ActorEvent{Timestamp: ts, ActorId: actorId, EventType: EventType(eventType), Level: Level(level), Event: event}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// buildEventsLogWhere turns the GetEvents/ReplayEvents filter arguments into a parameterized WHERE
+// clause. Predicates are pushed down to ClickHouse rather than filtered in Go.
+func (r *ClickhouseEventsLog) buildEventsLogWhere(eventType EventType, actorId string, level string, filter *EventsLogFilter) (string, []any) {
+	conditions := []string{"1=1"}
+	var args []any
+
+	if eventType != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, string(eventType))
+	}
+	if actorId != "" {
+		conditions = append(conditions, "actorId = ?")
+		args = append(args, actorId)
+	}
+	if level != "" {
+		conditions = append(conditions, "level = ?")
+		args = append(args, level)
+	}
+	if filter != nil {
+		if !filter.Start.IsZero() {
+			conditions = append(conditions, "timestamp >= ?")
+			args = append(args, filter.Start)
+		}
+		if !filter.End.IsZero() {
+			conditions = append(conditions, "timestamp <= ?")
+			args = append(args, filter.End)
+		}
+		if filter.Filter != "" {
+			conditions = append(conditions, "positionCaseInsensitive(data, ?) > 0")
+			args = append(args, filter.Filter)
+		}
+		if !filter.AfterTimestamp.IsZero() {
+			conditions = append(conditions, "(timestamp, actorId) > (?, ?)")
+			args = append(args, filter.AfterTimestamp, filter.AfterActorId)
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
 }
 
 func (r *ClickhouseEventsLog) InsertTaskLog(level, logger, message, syncId, taskId string, timestamp time.Time) error {
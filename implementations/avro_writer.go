@@ -0,0 +1,188 @@
+package implementations
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jitsucom/bulker/types"
+	"github.com/linkedin/goavro/v2"
+	"io"
+	"time"
+)
+
+// AvroWriter streams objects matching a bulker Table into an Avro Object Container File.
+type AvroWriter struct {
+	ocfWriter *goavro.OCFWriter
+	table     *types.Table
+	columns   []string
+	//avroTypes maps column name to its avro union branch name (e.g. "long", "string"), since every
+	//column is nullable and goavro requires union values wrapped as map[string]any{branch: value}.
+	avroTypes map[string]string
+}
+
+// NewAvroWriter derives an Avro record schema from table.Columns and returns a writer that appends
+// rows to w as they're written. compression selects the OCF block codec (default snappy).
+func NewAvroWriter(w io.Writer, table *types.Table, compression Compression) (*AvroWriter, error) {
+	columns := table.SortedColumnNames()
+	avroTypes := make(map[string]string, len(columns))
+	schemaTypes := make(map[string]any, len(columns))
+	for _, name := range columns {
+		avroTypes[name] = avroTypeForColumn(table.Columns[name])
+		schemaTypes[name] = avroSchemaTypeForColumn(table.Columns[name])
+	}
+
+	schemaJSON, err := avroSchemaForTable(table, columns, schemaTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive avro schema: %v", err)
+	}
+
+	ocfWriter, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:               w,
+		Schema:          schemaJSON,
+		CompressionName: avroCodecName(compression),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create avro writer: %v", err)
+	}
+
+	return &AvroWriter{ocfWriter: ocfWriter, table: table, columns: columns, avroTypes: avroTypes}, nil
+}
+
+func avroCodecName(c Compression) string {
+	switch c {
+	case CompressionSnappy, CompressionNone:
+		return goavro.CompressionSnappyLabel
+	case CompressionGZIP:
+		return goavro.CompressionDeflateLabel
+	default:
+		return goavro.CompressionNullLabel
+	}
+}
+
+type avroField struct {
+	Name string `json:"name"`
+	Type any    `json:"type"`
+}
+
+type avroRecordSchema struct {
+	Type   string      `json:"type"`
+	Name   string      `json:"name"`
+	Fields []avroField `json:"fields"`
+}
+
+func avroSchemaForTable(table *types.Table, columns []string, schemaTypes map[string]any) (string, error) {
+	fields := make([]avroField, 0, len(columns))
+	for _, name := range columns {
+		fields = append(fields, avroField{Name: name, Type: []any{"null", schemaTypes[name]}})
+	}
+	b, err := json.Marshal(avroRecordSchema{Type: "record", Name: table.Name, Fields: fields})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// avroTypeForColumn maps a bulker SQLColumn's generic DataType to the Avro union branch name used
+// to wrap non-null values for Append (goavro keys union values by the underlying primitive type
+// name, e.g. "long", even when the schema annotates that "long" with a logicalType).
+func avroTypeForColumn(col types.SQLColumn) string {
+	switch col.Type {
+	case types.INTEGER:
+		return "long"
+	case types.FLOAT64:
+		return "double"
+	case types.TIMESTAMP:
+		return "long"
+	case types.BOOL:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// avroSchemaTypeForColumn maps a bulker SQLColumn's generic DataType to the Avro schema type to
+// declare for that column's union branch. This differs from avroTypeForColumn only for TIMESTAMP,
+// which must be declared as {"type":"long","logicalType":"timestamp-micros"} - a bare "long" would
+// make a warehouse loading the Avro file materialize the column as a plain integer instead of a
+// timestamp.
+func avroSchemaTypeForColumn(col types.SQLColumn) any {
+	if col.Type == types.TIMESTAMP {
+		return map[string]any{"type": "long", "logicalType": "timestamp-micros"}
+	}
+	return avroTypeForColumn(col)
+}
+
+// Append writes a single row to the underlying OCF file. row must contain a value (or nil) for
+// every column in the derived schema. Every field is a ["null", <type>] union, so goavro requires
+// non-null values wrapped as map[string]any{<type>: value} - a bare scalar is rejected at encode
+// time - and each value is coerced to the Go type its avro branch expects (e.g. int64 for "long").
+func (aw *AvroWriter) Append(row map[string]any) error {
+	record := make(map[string]any, len(aw.columns))
+	for _, name := range aw.columns {
+		v := row[name]
+		if v == nil {
+			record[name] = nil
+			continue
+		}
+		record[name] = map[string]any{aw.avroTypes[name]: avroValueFor(aw.table.Columns[name], v)}
+	}
+	return aw.ocfWriter.Append([]any{record})
+}
+
+// avroValueFor coerces v to the Go type matching col's avro union branch (avroTypeForColumn).
+func avroValueFor(col types.SQLColumn, v any) any {
+	switch col.Type {
+	case types.INTEGER:
+		return avroInt64Value(v)
+	case types.FLOAT64:
+		return avroFloat64Value(v)
+	case types.TIMESTAMP:
+		if t, ok := v.(time.Time); ok {
+			return t.UnixMicro()
+		}
+		return avroInt64Value(v)
+	case types.BOOL:
+		b, _ := v.(bool)
+		return b
+	default:
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func avroInt64Value(v any) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+func avroFloat64Value(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	default:
+		return 0
+	}
+}
+
+// Close does nothing: goavro's OCFWriter has no explicit Close, writes are flushed to the
+// underlying io.Writer as each block is appended.
+func (aw *AvroWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,164 @@
+package implementations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/jitsucom/bulker/base/errorj"
+	"github.com/jitsucom/bulker/base/logging"
+	"github.com/jitsucom/bulker/base/timestamp"
+	"github.com/jitsucom/bulker/types"
+	"io"
+
+	"go.uber.org/atomic"
+)
+
+type AzureConfig struct {
+	Container   string     `mapstructure:"azure_container,omitempty" json:"azure_container,omitempty" yaml:"azure_container,omitempty"`
+	AccountName string     `mapstructure:"azure_account_name,omitempty" json:"azure_account_name,omitempty" yaml:"azure_account_name,omitempty"`
+	AccountKey  string     `mapstructure:"azure_account_key,omitempty" json:"azure_account_key,omitempty" yaml:"azure_account_key,omitempty"`
+	//SASToken can be used instead of AccountKey for delegated access
+	SASToken string     `mapstructure:"azure_sas_token,omitempty" json:"azure_sas_token,omitempty" yaml:"azure_sas_token,omitempty"`
+	Format   FileFormat `mapstructure:"format,omitempty" json:"format,omitempty" yaml:"format,omitempty"`
+
+	//will be set on validation
+	serviceURL string
+	credential azcore.TokenCredential
+	sharedKey  *azblob.SharedKeyCredential
+}
+
+func (ac *AzureConfig) Validate() error {
+	if ac == nil {
+		return errors.New("Azure config is required")
+	}
+	if ac.Container == "" {
+		return errors.New("azure_container is required parameter")
+	}
+	if ac.AccountName == "" {
+		return errors.New("azure_account_name is required parameter")
+	}
+
+	ac.serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", ac.AccountName)
+
+	if ac.AccountKey != "" {
+		cred, err := azblob.NewSharedKeyCredential(ac.AccountName, ac.AccountKey)
+		if err != nil {
+			return fmt.Errorf("invalid azure_account_key: %v", err)
+		}
+		ac.sharedKey = cred
+	} else if ac.SASToken == "" {
+		return errors.New("either azure_account_key or azure_sas_token is required parameter")
+	}
+
+	return nil
+}
+
+// AzureBlob is a StageFileStorage implementation backed by Azure Blob Storage
+type AzureBlob struct {
+	config *AzureConfig
+	client *azblob.Client
+	ctx    context.Context
+
+	closed *atomic.Bool
+}
+
+func NewAzureBlob(ctx context.Context, config *AzureConfig) (*AzureBlob, error) {
+	if config.Format == "" {
+		config.Format = JSON
+	}
+
+	var client *azblob.Client
+	var err error
+	if config.sharedKey != nil {
+		client, err = azblob.NewClientWithSharedKeyCredential(config.serviceURL, config.sharedKey, nil)
+	} else {
+		client, err = azblob.NewClientWithNoCredential(config.serviceURL+"?"+config.SASToken, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error creating azure blob storage client: %v", err)
+	}
+
+	return &AzureBlob{client: client, config: config, ctx: ctx, closed: atomic.NewBool(false)}, nil
+}
+
+func (ab *AzureBlob) Format() FileFormat {
+	return ab.config.Format
+}
+
+func (ab *AzureBlob) UploadBytes(fileName string, fileBytes []byte) error {
+	return ab.Upload(fileName, bytes.NewReader(fileBytes))
+}
+
+// Upload creates named blob on Azure Blob Storage with payload
+func (ab *AzureBlob) Upload(fileName string, fileReader io.ReadSeeker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while uploading file: %s to Azure container: %s : %v", fileName, ab.config.Container, r)
+			logging.SystemErrorf(err.Error())
+		}
+	}()
+	if ab.closed.Load() {
+		return fmt.Errorf("attempt to use closed AzureBlob instance")
+	}
+
+	_, err = ab.client.UploadStream(ab.ctx, ab.config.Container, fileName, io.NopCloser(fileReader), nil)
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to write file to azure blob storage").
+			WithProperty(errorj.DBInfo, &types.ErrorPayload{
+				Bucket:    ab.config.Container,
+				Statement: fmt.Sprintf("file: %s", fileName),
+			})
+	}
+
+	return nil
+}
+
+// DeleteObject deletes blob from Azure container
+func (ab *AzureBlob) DeleteObject(key string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while deleting file: %s from Azure container: %s : %v", key, ab.config.Container, r)
+			logging.SystemErrorf(err.Error())
+		}
+	}()
+	if ab.closed.Load() {
+		return fmt.Errorf("attempt to use closed AzureBlob instance")
+	}
+
+	_, err = ab.client.DeleteBlob(ab.ctx, ab.config.Container, key, nil)
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to delete from azure blob storage").
+			WithProperty(errorj.DBInfo, &types.ErrorPayload{
+				Bucket:    ab.config.Container,
+				Statement: fmt.Sprintf("file: %s", key),
+			})
+	}
+
+	return nil
+}
+
+// ValidateWritePermission tries to create temporary file and remove it.
+// returns nil if file creation was successful.
+func (ab *AzureBlob) ValidateWritePermission() error {
+	filename := fmt.Sprintf("test_%v", timestamp.NowUTC())
+
+	if err := ab.UploadBytes(filename, []byte{}); err != nil {
+		return err
+	}
+
+	if err := ab.DeleteObject(filename); err != nil {
+		logging.Warnf("Cannot remove blob %q from Azure Blob Storage: %v", filename, err)
+		// Suppressing error because we need to check only write permission
+	}
+
+	return nil
+}
+
+// Close marks the AzureBlob client as closed
+func (ab *AzureBlob) Close() error {
+	ab.closed.Store(true)
+	return nil
+}
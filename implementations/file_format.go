@@ -0,0 +1,26 @@
+package implementations
+
+// FileFormat is the on-disk format used for batch files staged before a DWH load.
+type FileFormat string
+
+const (
+	// JSON is newline-delimited JSON, the default format. Simple but slow/expensive to load at scale.
+	JSON FileFormat = "ndjson"
+	// CSV is comma-separated values with a header row.
+	CSV FileFormat = "csv"
+	// Parquet is a columnar format. Redshift/BigQuery/Snowflake all load it an order of magnitude
+	// faster and cheaper than JSON.
+	Parquet FileFormat = "parquet"
+	// Avro is a row-oriented binary format with an embedded schema.
+	Avro FileFormat = "avro"
+)
+
+// Compression is the compression codec applied to a staged batch file.
+type Compression string
+
+const (
+	CompressionNone   Compression = ""
+	CompressionSnappy Compression = "SNAPPY"
+	CompressionZSTD   Compression = "ZSTD"
+	CompressionGZIP   Compression = "GZIP"
+)
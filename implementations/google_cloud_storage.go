@@ -12,25 +12,73 @@ import (
 	"github.com/jitsucom/bulker/types"
 	jsoniter "github.com/json-iterator/go"
 	"io"
+	"net/http"
 	"strings"
+	"time"
 
 	"go.uber.org/atomic"
 
+	"cloud.google.com/go/compute/metadata"
 	"cloud.google.com/go/storage"
+	"github.com/googleapis/gax-go/v2"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
 )
 
+// gcsChunkSize is the default chunk size (in bytes) used for resumable uploads.
+// Chosen as a multiple of googleapi.MinUploadChunkSize (256KiB).
+const gcsChunkSize = 16 * 1024 * 1024
+
+// gcsChunkRetryDeadline bounds how long the storage.Writer will keep retrying a single chunk
+// commit (via its own resumable-session retry, not ours) before giving up on the upload.
+const gcsChunkRetryDeadline = 5 * time.Minute
+
 var ErrMalformedBQDataset = errors.New("bq_dataset must be alphanumeric (plus underscores) and must be at most 1024 characters long")
 
+// AuthMode selects how GoogleConfig resolves credentials. Replaces the previous behavior of
+// special-casing the literal KeyFile value "workload_identity".
+type AuthMode string
+
+const (
+	AuthModeServiceAccountJSON AuthMode = "service_account_json"
+	AuthModeServiceAccountFile AuthMode = "service_account_file"
+	AuthModeWorkloadIdentity   AuthMode = "workload_identity"
+	AuthModeApplicationDefault AuthMode = "application_default"
+	AuthModeImpersonatedSA     AuthMode = "impersonated_sa"
+	AuthModeAccessToken        AuthMode = "access_token"
+)
+
 type GoogleConfig struct {
 	Bucket  string     `mapstructure:"gcs_bucket,omitempty" json:"gcs_bucket,omitempty" yaml:"gcs_bucket,omitempty"`
 	Project string     `mapstructure:"project,omitempty" json:"project,omitempty" yaml:"project,omitempty"`
 	Dataset string     `mapstructure:"bq_dataset,omitempty" json:"bq_dataset,omitempty" yaml:"bq_dataset,omitempty"`
-	KeyFile any        `mapstructure:"key_file,omitempty" json:"key_file,omitempty" yaml:"key_file,omitempty"`
 	Format  FileFormat `mapstructure:"format,omitempty" json:"format,omitempty" yaml:"format,omitempty"`
+	//Compression applies to Parquet/Avro staged files. Ignored for JSON/CSV.
+	Compression Compression `mapstructure:"compression,omitempty" json:"compression,omitempty" yaml:"compression,omitempty"`
+	//KMSKeyName, when set, is used as the customer-managed encryption key for staged objects,
+	//e.g. "projects/P/locations/L/keyRings/R/cryptoKeys/K".
+	KMSKeyName string `mapstructure:"kms_key_name,omitempty" json:"kms_key_name,omitempty" yaml:"kms_key_name,omitempty"`
+
+	//AuthMode selects the credential strategy. If empty, it's inferred from KeyFile for backward
+	//compatibility: service_account_json when KeyFile is set, application_default otherwise.
+	AuthMode AuthMode `mapstructure:"auth_mode,omitempty" json:"auth_mode,omitempty" yaml:"auth_mode,omitempty"`
+	//KeyFile holds service account credentials: a JSON object/string for service_account_json,
+	//or a file path for service_account_file.
+	KeyFile any `mapstructure:"key_file,omitempty" json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	//AccessToken is a pre-obtained OAuth2 access token, used when AuthMode is access_token.
+	AccessToken string `mapstructure:"access_token,omitempty" json:"access_token,omitempty" yaml:"access_token,omitempty"`
+	//ImpersonateServiceAccount is the target service account email to impersonate when AuthMode is impersonated_sa.
+	ImpersonateServiceAccount string `mapstructure:"impersonate_service_account,omitempty" json:"impersonate_service_account,omitempty" yaml:"impersonate_service_account,omitempty"`
+	//ImpersonateDelegates is an optional chain of intermediate service accounts to impersonate through.
+	ImpersonateDelegates []string `mapstructure:"impersonate_delegates,omitempty" json:"impersonate_delegates,omitempty" yaml:"impersonate_delegates,omitempty"`
+
+	//HTTPClient, when set by the caller before Validate(), is used for all storage/BigQuery API calls
+	//instead of the default transport - e.g. to route through a proxy in restricted network environments.
+	HTTPClient *http.Client `mapstructure:"-" json:"-" yaml:"-"`
 
 	//will be set on validation
-	Credentials option.ClientOption
+	Credentials []option.ClientOption
 }
 
 func (gc *GoogleConfig) Validate() error {
@@ -50,32 +98,78 @@ func (gc *GoogleConfig) Validate() error {
 			}
 		}
 	}
-	switch gc.KeyFile.(type) {
-	case map[string]any:
-		keyFileObject := gc.KeyFile.(map[string]any)
-		if len(keyFileObject) == 0 {
-			return errors.New("Google key_file is required parameter")
+
+	mode := gc.AuthMode
+	if mode == "" {
+		switch gc.KeyFile.(type) {
+		case map[string]any, string:
+			mode = AuthModeServiceAccountJSON
+		default:
+			mode = AuthModeApplicationDefault
 		}
-		b, err := jsoniter.Marshal(keyFileObject)
-		if err != nil {
-			return fmt.Errorf("Malformed google key_file: %v", err)
+	}
+
+	switch mode {
+	case AuthModeServiceAccountJSON:
+		switch keyFile := gc.KeyFile.(type) {
+		case map[string]any:
+			if len(keyFile) == 0 {
+				return errors.New("Google key_file is required parameter")
+			}
+			b, err := jsoniter.Marshal(keyFile)
+			if err != nil {
+				return fmt.Errorf("Malformed google key_file: %v", err)
+			}
+			gc.Credentials = append(gc.Credentials, option.WithCredentialsJSON(b))
+		case string:
+			if keyFile == "" {
+				return errors.New("Google key_file is required parameter")
+			}
+			if strings.Contains(keyFile, "{") {
+				gc.Credentials = append(gc.Credentials, option.WithCredentialsJSON([]byte(keyFile)))
+			} else {
+				gc.Credentials = append(gc.Credentials, option.WithCredentialsFile(keyFile))
+			}
+		default:
+			return errors.New("Google key_file must be string or json object")
 		}
-		gc.Credentials = option.WithCredentialsJSON(b)
-	case string:
-		keyFile := gc.KeyFile.(string)
-		if keyFile == "workload_identity" {
-			return nil
+	case AuthModeServiceAccountFile:
+		keyFile, ok := gc.KeyFile.(string)
+		if !ok || keyFile == "" {
+			return errors.New("Google key_file path is required parameter for service_account_file auth_mode")
 		}
-		if keyFile == "" {
-			return errors.New("Google key file is required parameter")
+		gc.Credentials = append(gc.Credentials, option.WithCredentialsFile(keyFile))
+	case AuthModeWorkloadIdentity:
+		if !metadata.OnGCE() {
+			return errors.New("auth_mode workload_identity requires running on GCE/GKE with a metadata server")
 		}
-		if strings.Contains(keyFile, "{") {
-			gc.Credentials = option.WithCredentialsJSON([]byte(keyFile))
-		} else {
-			gc.Credentials = option.WithCredentialsFile(keyFile)
+		//no explicit credentials option - ADC resolves to the attached workload identity
+	case AuthModeApplicationDefault:
+		//no explicit credentials option - ADC resolves from the environment
+	case AuthModeImpersonatedSA:
+		if gc.ImpersonateServiceAccount == "" {
+			return errors.New("impersonate_service_account is required for impersonated_sa auth_mode")
 		}
+		ts, err := impersonate.CredentialsTokenSource(context.Background(), impersonate.CredentialsConfig{
+			TargetPrincipal: gc.ImpersonateServiceAccount,
+			Scopes:          []string{"https://www.googleapis.com/auth/cloud-platform"},
+			Delegates:       gc.ImpersonateDelegates,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to set up impersonated credentials for %s: %v", gc.ImpersonateServiceAccount, err)
+		}
+		gc.Credentials = append(gc.Credentials, option.WithTokenSource(ts))
+	case AuthModeAccessToken:
+		if gc.AccessToken == "" {
+			return errors.New("access_token is required for access_token auth_mode")
+		}
+		gc.Credentials = append(gc.Credentials, option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: gc.AccessToken})))
 	default:
-		return errors.New("Google key_file must be string or json object")
+		return fmt.Errorf("unsupported google auth_mode: %s", mode)
+	}
+
+	if gc.HTTPClient != nil {
+		gc.Credentials = append(gc.Credentials, option.WithHTTPClient(gc.HTTPClient))
 	}
 
 	return nil
@@ -90,13 +184,7 @@ type GoogleCloudStorage struct {
 }
 
 func NewGoogleCloudStorage(ctx context.Context, config *GoogleConfig) (*GoogleCloudStorage, error) {
-	var client *storage.Client
-	var err error
-	if config.Credentials == nil {
-		client, err = storage.NewClient(ctx)
-	} else {
-		client, err = storage.NewClient(ctx, config.Credentials)
-	}
+	client, err := storage.NewClient(ctx, config.Credentials...)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating google cloud storage client: %v", err)
 	}
@@ -112,16 +200,43 @@ func (gcs *GoogleCloudStorage) Format() FileFormat {
 	return gcs.config.Format
 }
 
+// KMSKeyName returns the configured CMEK key resource name, or "" if staged objects aren't
+// encrypted with a customer-managed key. SQL adapters surface it via GetStageEncryptionKMSId; only
+// Snowflake COPY INTO gets an encryption clause from it (see sql.EncryptionClause), BigQuery LOAD DATA
+// gets none.
+func (gcs *GoogleCloudStorage) KMSKeyName() string {
+	return gcs.config.KMSKeyName
+}
+
 func (gcs *GoogleCloudStorage) UploadBytes(fileName string, fileBytes []byte) error {
 	return gcs.Upload(fileName, bytes.NewReader(fileBytes))
 }
 
 // UploadBytes creates named file on google cloud storage with payload
 func (gcs *GoogleCloudStorage) Upload(fileName string, fileReader io.ReadSeeker) (err error) {
+	return gcs.upload(fileName, fileReader, -1, nil)
+}
+
+// UploadReader creates named file on google cloud storage from r, without requiring io.ReadSeeker.
+// size may be -1 if unknown; this lets callers stream from Kafka/HTTP without buffering to disk first.
+func (gcs *GoogleCloudStorage) UploadReader(fileName string, r io.Reader, size int64) error {
+	return gcs.upload(fileName, r, size, nil)
+}
+
+// UploadWithProgress is like Upload but reports cumulative bytes written to progress after every chunk commit.
+func (gcs *GoogleCloudStorage) UploadWithProgress(fileName string, fileReader io.ReadSeeker, progress io.Writer) error {
+	return gcs.upload(fileName, fileReader, -1, progress)
+}
+
+// upload writes r to fileName using a resumable, chunked storage.Writer: the object's Retryer and
+// w.ChunkRetryDeadline give each chunk commit exponential-backoff retries internally, so a single
+// network blip doesn't abort the whole transfer. An in-progress upload is aborted (rather than left
+// dangling) if copying r into w fails after the writer's own retries are exhausted.
+func (gcs *GoogleCloudStorage) upload(fileName string, r io.Reader, size int64, progress io.Writer) (err error) {
 	//panic handler
 	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic while uploading file: %s to GCC project: %s bucket: %s dataset: %s : %v", fileName, gcs.config.Project, gcs.config.Bucket, gcs.config.Dataset, r)
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic while uploading file: %s to GCC project: %s bucket: %s dataset: %s : %v", fileName, gcs.config.Project, gcs.config.Bucket, gcs.config.Dataset, rec)
 			logging.SystemErrorf(err.Error())
 		}
 	}()
@@ -130,14 +245,28 @@ func (gcs *GoogleCloudStorage) Upload(fileName string, fileReader io.ReadSeeker)
 	}
 
 	bucket := gcs.client.Bucket(gcs.config.Bucket)
-	object := bucket.Object(fileName)
-	w := object.NewWriter(gcs.ctx)
+	object := bucket.Object(fileName).Retryer(
+		storage.WithBackoff(gax.Backoff{Initial: 100 * time.Millisecond, Max: 5 * time.Second, Multiplier: 2}),
+		storage.WithPolicy(storage.RetryAlways),
+	)
+	//cancelling ctx before Close is how a storage.Writer discards an upload instead of committing it
+	ctx, cancel := context.WithCancel(gcs.ctx)
+	defer cancel()
+	w := object.NewWriter(ctx)
+	w.ChunkSize = gcsChunkSize
+	w.ChunkRetryDeadline = gcsChunkRetryDeadline
+	if gcs.config.KMSKeyName != "" {
+		w.KMSKeyName = gcs.config.KMSKeyName
+	}
 
-	if _, err := io.Copy(w, fileReader); err != nil {
-		return errorj.SaveOnStageError.Wrap(err, "failed to write file to google cloud storage").
+	written, copyErr := gcs.copyWithProgress(w, r, progress)
+	if copyErr != nil {
+		cancel()
+		_ = w.Close()
+		return errorj.SaveOnStageError.Wrap(copyErr, "failed to write file to google cloud storage").
 			WithProperty(errorj.DBInfo, &types.ErrorPayload{
 				Bucket:    gcs.config.Bucket,
-				Statement: fmt.Sprintf("file: %s", fileName),
+				Statement: fmt.Sprintf("file: %s (%d bytes written)", fileName, written),
 			})
 	}
 
@@ -152,6 +281,34 @@ func (gcs *GoogleCloudStorage) Upload(fileName string, fileReader io.ReadSeeker)
 	return nil
 }
 
+// copyWithProgress copies r into w in gcsChunkSize pieces, reporting cumulative bytes written after
+// every chunk. Chunk-level retries are handled by w itself (ChunkRetryDeadline plus the bucket
+// object's configured Retryer) rather than here: a resumable storage.Writer that returns an error
+// from Write has already exhausted its own retry budget for that chunk and is left in a permanently
+// errored state, so retrying the Write call here would just re-observe the same failure.
+func (gcs *GoogleCloudStorage) copyWithProgress(w io.Writer, r io.Reader, progress io.Writer) (int64, error) {
+	var written int64
+	buf := make([]byte, gcsChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return written, writeErr
+			}
+			written += int64(n)
+			if progress != nil {
+				_, _ = fmt.Fprintf(progress, "%d\n", written)
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+	}
+}
+
 // DeleteObject deletes object from google cloud storage bucket
 func (gcs *GoogleCloudStorage) DeleteObject(key string) (err error) {
 	//panic handler
@@ -0,0 +1,137 @@
+package implementations
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/jitsucom/bulker/base/errorj"
+	"github.com/jitsucom/bulker/base/logging"
+	"github.com/jitsucom/bulker/base/timestamp"
+	"github.com/jitsucom/bulker/types"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/atomic"
+)
+
+type LocalFSConfig struct {
+	//Dir is the directory staged files are written to. Created on first use if it doesn't exist.
+	Dir    string     `mapstructure:"local_fs_dir,omitempty" json:"local_fs_dir,omitempty" yaml:"local_fs_dir,omitempty"`
+	Format FileFormat `mapstructure:"format,omitempty" json:"format,omitempty" yaml:"format,omitempty"`
+}
+
+func (lc *LocalFSConfig) Validate() error {
+	if lc == nil {
+		return errors.New("LocalFS config is required")
+	}
+	if lc.Dir == "" {
+		return errors.New("local_fs_dir is required parameter")
+	}
+	return nil
+}
+
+// LocalFS is a StageFileStorage implementation backed by the local filesystem.
+// It is intended for dev/testing where a real cloud bucket isn't available.
+type LocalFS struct {
+	config *LocalFSConfig
+
+	closed *atomic.Bool
+}
+
+func NewLocalFS(config *LocalFSConfig) (*LocalFS, error) {
+	if config.Format == "" {
+		config.Format = JSON
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating local fs directory %s: %v", config.Dir, err)
+	}
+
+	return &LocalFS{config: config, closed: atomic.NewBool(false)}, nil
+}
+
+func (lfs *LocalFS) Format() FileFormat {
+	return lfs.config.Format
+}
+
+func (lfs *LocalFS) UploadBytes(fileName string, fileBytes []byte) error {
+	return lfs.Upload(fileName, bytes.NewReader(fileBytes))
+}
+
+// Upload writes named file into the configured directory
+func (lfs *LocalFS) Upload(fileName string, fileReader io.ReadSeeker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while uploading file: %s to local fs dir: %s : %v", fileName, lfs.config.Dir, r)
+			logging.SystemErrorf(err.Error())
+		}
+	}()
+	if lfs.closed.Load() {
+		return fmt.Errorf("attempt to use closed LocalFS instance")
+	}
+
+	path := filepath.Join(lfs.config.Dir, fileName)
+	f, err := os.Create(path)
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to create file on local fs").
+			WithProperty(errorj.DBInfo, &types.ErrorPayload{
+				Statement: fmt.Sprintf("file: %s", path),
+			})
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, fileReader); err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to write file to local fs").
+			WithProperty(errorj.DBInfo, &types.ErrorPayload{
+				Statement: fmt.Sprintf("file: %s", path),
+			})
+	}
+
+	return nil
+}
+
+// DeleteObject removes file from the configured directory
+func (lfs *LocalFS) DeleteObject(key string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while deleting file: %s from local fs dir: %s : %v", key, lfs.config.Dir, r)
+			logging.SystemErrorf(err.Error())
+		}
+	}()
+	if lfs.closed.Load() {
+		return fmt.Errorf("attempt to use closed LocalFS instance")
+	}
+
+	path := filepath.Join(lfs.config.Dir, key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errorj.SaveOnStageError.Wrap(err, "failed to delete file from local fs").
+			WithProperty(errorj.DBInfo, &types.ErrorPayload{
+				Statement: fmt.Sprintf("file: %s", path),
+			})
+	}
+
+	return nil
+}
+
+// ValidateWritePermission tries to create temporary file and remove it.
+// returns nil if file creation was successful.
+func (lfs *LocalFS) ValidateWritePermission() error {
+	filename := fmt.Sprintf("test_%v", timestamp.NowUTC())
+
+	if err := lfs.UploadBytes(filename, []byte{}); err != nil {
+		return err
+	}
+
+	if err := lfs.DeleteObject(filename); err != nil {
+		logging.Warnf("Cannot remove file %q from local fs: %v", filename, err)
+		// Suppressing error because we need to check only write permission
+	}
+
+	return nil
+}
+
+// Close is a no-op for LocalFS, it holds no resources to release
+func (lfs *LocalFS) Close() error {
+	lfs.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,192 @@
+package implementations
+
+import (
+	"fmt"
+	"github.com/apache/arrow/go/v14/parquet"
+	"github.com/apache/arrow/go/v14/parquet/compress"
+	"github.com/apache/arrow/go/v14/parquet/file"
+	"github.com/apache/arrow/go/v14/parquet/schema"
+	"github.com/jitsucom/bulker/types"
+	"io"
+	"time"
+)
+
+// parquetRowGroupBufferSize caps how many buffered rows accumulate before ParquetWriter flushes a
+// row group, so a large batch doesn't hold every row in memory until Close.
+const parquetRowGroupBufferSize = 10000
+
+// ParquetWriter streams objects matching a bulker Table into a Parquet file, one row at a time.
+type ParquetWriter struct {
+	table    *types.Table
+	columns  []string
+	fw       *file.Writer
+	rgw      file.BufferedRowGroupWriter
+	buffered int
+}
+
+// NewParquetWriter derives a Parquet schema from table.Columns (via SQLColumn) and returns a writer
+// that appends rows to w as they're written. compression selects the page codec (default SNAPPY).
+func NewParquetWriter(w io.Writer, table *types.Table, compression Compression) (*ParquetWriter, error) {
+	columns := table.SortedColumnNames()
+	fields := make(schema.FieldList, 0, len(columns))
+	for _, name := range columns {
+		col := table.Columns[name]
+		node, err := parquetNodeForColumn(name, col)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive parquet schema for column %q: %v", name, err)
+		}
+		fields = append(fields, node)
+	}
+	root, err := schema.NewGroupNode("schema", parquet.Repetitions.Required, fields, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build parquet schema: %v", err)
+	}
+
+	props := parquet.NewWriterProperties(parquet.WithCompression(parquetCodec(compression)))
+	fw := file.NewParquetWriter(w, root, file.WithWriterProps(props))
+
+	pw := &ParquetWriter{table: table, columns: columns, fw: fw}
+	pw.rgw = fw.AppendBufferedRowGroup()
+	return pw, nil
+}
+
+func parquetCodec(c Compression) compress.Compression {
+	switch c {
+	case CompressionSnappy:
+		return compress.Codecs.Snappy
+	case CompressionZSTD:
+		return compress.Codecs.Zstd
+	case CompressionGZIP:
+		return compress.Codecs.Gzip
+	default:
+		return compress.Codecs.Snappy
+	}
+}
+
+// parquetNodeForColumn maps a bulker SQLColumn's generic DataType to the closest Parquet primitive type.
+func parquetNodeForColumn(name string, col types.SQLColumn) (schema.Node, error) {
+	switch col.Type {
+	case types.INTEGER:
+		return schema.NewInt64Node(name, parquet.Repetitions.Optional, -1)
+	case types.FLOAT64:
+		return schema.NewFloat64Node(name, parquet.Repetitions.Optional, -1)
+	case types.TIMESTAMP:
+		return schema.NewPrimitiveNodeLogical(name, parquet.Repetitions.Optional, schema.NewTimestampLogicalType(true, schema.TimeUnitMicros), parquet.Types.Int64, 0, -1)
+	case types.BOOL:
+		return schema.NewBooleanNode(name, parquet.Repetitions.Optional, -1)
+	default:
+		return schema.NewByteArrayNode(name, parquet.Repetitions.Optional, -1)
+	}
+}
+
+// Append writes one row, keyed by column name, to the current row group, flushing it to the file
+// every parquetRowGroupBufferSize rows so memory use stays bounded on large batches.
+func (pw *ParquetWriter) Append(row map[string]any) error {
+	for i, name := range pw.columns {
+		if err := writeParquetValue(pw.rgw.Column(i), pw.table.Columns[name].Type, row[name]); err != nil {
+			return fmt.Errorf("failed to write parquet value for column %q: %v", name, err)
+		}
+	}
+	pw.buffered++
+	if pw.buffered >= parquetRowGroupBufferSize {
+		return pw.flush()
+	}
+	return nil
+}
+
+// flush closes the current buffered row group (committing it to the file) and opens a new one.
+func (pw *ParquetWriter) flush() error {
+	if pw.buffered == 0 {
+		return nil
+	}
+	if err := pw.rgw.Close(); err != nil {
+		return fmt.Errorf("failed to close parquet row group: %v", err)
+	}
+	pw.rgw = pw.fw.AppendBufferedRowGroup()
+	pw.buffered = 0
+	return nil
+}
+
+// writeParquetValue appends a single value to col as a one-row batch. A nil value is written as a
+// null (definition level 0); every column is Optional (see parquetNodeForColumn), so nulls are valid.
+func writeParquetValue(col file.ColumnChunkWriter, dataType types.DataType, v any) error {
+	defLevel := int16(1)
+	if v == nil {
+		defLevel = 0
+	}
+	var err error
+	switch w := col.(type) {
+	case *file.Int64ColumnChunkWriter:
+		var vals [1]int64
+		if v != nil {
+			vals[0] = parquetInt64Value(dataType, v)
+		}
+		_, err = w.WriteBatch(vals[:], []int16{defLevel}, nil)
+	case *file.Float64ColumnChunkWriter:
+		var vals [1]float64
+		if v != nil {
+			vals[0] = parquetFloat64Value(v)
+		}
+		_, err = w.WriteBatch(vals[:], []int16{defLevel}, nil)
+	case *file.BooleanColumnChunkWriter:
+		var vals [1]bool
+		if v != nil {
+			vals[0], _ = v.(bool)
+		}
+		_, err = w.WriteBatch(vals[:], []int16{defLevel}, nil)
+	case *file.ByteArrayColumnChunkWriter:
+		var vals [1]parquet.ByteArray
+		if v != nil {
+			vals[0] = parquet.ByteArray(fmt.Sprintf("%v", v))
+		}
+		_, err = w.WriteBatch(vals[:], []int16{defLevel}, nil)
+	default:
+		return fmt.Errorf("unsupported parquet column writer type %T", col)
+	}
+	return err
+}
+
+// parquetInt64Value converts v to the int64 a Parquet INT64-backed column expects. TIMESTAMP
+// columns are stored as microseconds since the epoch (see parquetNodeForColumn's TimeUnitMicros).
+func parquetInt64Value(dataType types.DataType, v any) int64 {
+	if dataType == types.TIMESTAMP {
+		if t, ok := v.(time.Time); ok {
+			return t.UnixMicro()
+		}
+	}
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	default:
+		return 0
+	}
+}
+
+func parquetFloat64Value(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	default:
+		return 0
+	}
+}
+
+// Close flushes any buffered row group and finalizes the Parquet footer.
+func (pw *ParquetWriter) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+	return pw.fw.Close()
+}
@@ -0,0 +1,216 @@
+package implementations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jitsucom/bulker/base/errorj"
+	"github.com/jitsucom/bulker/base/logging"
+	"github.com/jitsucom/bulker/base/timestamp"
+	"github.com/jitsucom/bulker/types"
+	"io"
+
+	"go.uber.org/atomic"
+)
+
+type S3Config struct {
+	Bucket          string     `mapstructure:"s3_bucket,omitempty" json:"s3_bucket,omitempty" yaml:"s3_bucket,omitempty"`
+	Region          string     `mapstructure:"s3_region,omitempty" json:"s3_region,omitempty" yaml:"s3_region,omitempty"`
+	AccessKeyID     string     `mapstructure:"s3_access_key_id,omitempty" json:"s3_access_key_id,omitempty" yaml:"s3_access_key_id,omitempty"`
+	SecretAccessKey string     `mapstructure:"s3_secret_access_key,omitempty" json:"s3_secret_access_key,omitempty" yaml:"s3_secret_access_key,omitempty"`
+	SessionToken    string     `mapstructure:"s3_session_token,omitempty" json:"s3_session_token,omitempty" yaml:"s3_session_token,omitempty"`
+	//Endpoint overrides the default AWS endpoint, for S3-compatible stores like MinIO or Cloudflare R2
+	Endpoint       string     `mapstructure:"s3_endpoint,omitempty" json:"s3_endpoint,omitempty" yaml:"s3_endpoint,omitempty"`
+	UsePathStyle   bool       `mapstructure:"s3_use_path_style,omitempty" json:"s3_use_path_style,omitempty" yaml:"s3_use_path_style,omitempty"`
+	Format         FileFormat `mapstructure:"format,omitempty" json:"format,omitempty" yaml:"format,omitempty"`
+	//Compression applies to Parquet/Avro staged files. Ignored for JSON/CSV.
+	Compression Compression `mapstructure:"compression,omitempty" json:"compression,omitempty" yaml:"compression,omitempty"`
+
+	//SSEType selects the server-side encryption mode applied to staged objects: "", "aws:kms" (SSE-KMS),
+	//"AES256" (SSE-S3) or "customer" (SSE-C).
+	SSEType string `mapstructure:"s3_sse_type,omitempty" json:"s3_sse_type,omitempty" yaml:"s3_sse_type,omitempty"`
+	//SSEKMSKeyId is the KMS key id/ARN used when SSEType is "aws:kms". Empty uses the AWS-managed key.
+	SSEKMSKeyId string `mapstructure:"s3_sse_kms_key_id,omitempty" json:"s3_sse_kms_key_id,omitempty" yaml:"s3_sse_kms_key_id,omitempty"`
+	//SSECustomerKey is the base64-encoded 256-bit key used when SSEType is "customer".
+	SSECustomerKey string `mapstructure:"s3_sse_customer_key,omitempty" json:"s3_sse_customer_key,omitempty" yaml:"s3_sse_customer_key,omitempty"`
+
+	//will be set on validation
+	awsConfig aws.Config
+}
+
+const (
+	s3SSEKMS      = "aws:kms"
+	s3SSES3       = "AES256"
+	s3SSECustomer = "customer"
+)
+
+func (sc *S3Config) Validate() error {
+	if sc == nil {
+		return errors.New("S3 config is required")
+	}
+	if sc.Bucket == "" {
+		return errors.New("s3_bucket is required parameter")
+	}
+	switch sc.SSEType {
+	case "", s3SSEKMS, s3SSES3:
+		//ok
+	case s3SSECustomer:
+		if sc.SSECustomerKey == "" {
+			return errors.New("s3_sse_customer_key is required when s3_sse_type is 'customer'")
+		}
+	default:
+		return fmt.Errorf("unsupported s3_sse_type: %s", sc.SSEType)
+	}
+
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(sc.Region)}
+	if sc.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(sc.AccessKeyID, sc.SecretAccessKey, sc.SessionToken)))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	sc.awsConfig = cfg
+	return nil
+}
+
+// S3 is a StageFileStorage implementation backed by AWS S3 (or an S3-compatible endpoint)
+type S3 struct {
+	config *S3Config
+	client *s3.Client
+	ctx    context.Context
+
+	closed *atomic.Bool
+}
+
+func NewS3(ctx context.Context, config *S3Config) (*S3, error) {
+	if config.Format == "" {
+		config.Format = JSON
+	}
+	client := s3.NewFromConfig(config.awsConfig, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+		o.UsePathStyle = config.UsePathStyle
+	})
+
+	return &S3{client: client, config: config, ctx: ctx, closed: atomic.NewBool(false)}, nil
+}
+
+func (s3s *S3) Format() FileFormat {
+	return s3s.config.Format
+}
+
+// KMSKeyId returns the configured SSE-KMS key id/ARN, or "" if staged objects aren't using SSE-KMS.
+// Snowflake's COPY INTO surfaces this as encryption=(type='aws_sse_kms' kms_key_id=...).
+func (s3s *S3) KMSKeyId() string {
+	if s3s.config.SSEType != s3SSEKMS {
+		return ""
+	}
+	return s3s.config.SSEKMSKeyId
+}
+
+func (s3s *S3) UploadBytes(fileName string, fileBytes []byte) error {
+	return s3s.Upload(fileName, bytes.NewReader(fileBytes))
+}
+
+// Upload creates named object on S3 with payload. Uses the multipart manager.Uploader so large
+// batch files don't need to fit in memory in a single PutObject call.
+func (s3s *S3) Upload(fileName string, fileReader io.ReadSeeker) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while uploading file: %s to S3 bucket: %s : %v", fileName, s3s.config.Bucket, r)
+			logging.SystemErrorf(err.Error())
+		}
+	}()
+	if s3s.closed.Load() {
+		return fmt.Errorf("attempt to use closed S3 instance")
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s3s.config.Bucket),
+		Key:    aws.String(fileName),
+		Body:   fileReader,
+	}
+	switch s3s.config.SSEType {
+	case s3SSEKMS:
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAwsKms
+		if s3s.config.SSEKMSKeyId != "" {
+			input.SSEKMSKeyId = aws.String(s3s.config.SSEKMSKeyId)
+		}
+	case s3SSES3:
+		input.ServerSideEncryption = s3types.ServerSideEncryptionAes256
+	case s3SSECustomer:
+		input.SSECustomerAlgorithm = aws.String("AES256")
+		input.SSECustomerKey = aws.String(s3s.config.SSECustomerKey)
+	}
+
+	uploader := manager.NewUploader(s3s.client)
+	_, err = uploader.Upload(s3s.ctx, input)
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to write file to S3").
+			WithProperty(errorj.DBInfo, &types.ErrorPayload{
+				Bucket:    s3s.config.Bucket,
+				Statement: fmt.Sprintf("file: %s", fileName),
+			})
+	}
+
+	return nil
+}
+
+// DeleteObject deletes object from S3 bucket
+func (s3s *S3) DeleteObject(key string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while deleting file: %s from S3 bucket: %s : %v", key, s3s.config.Bucket, r)
+			logging.SystemErrorf(err.Error())
+		}
+	}()
+	if s3s.closed.Load() {
+		return fmt.Errorf("attempt to use closed S3 instance")
+	}
+
+	_, err = s3s.client.DeleteObject(s3s.ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s3s.config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return errorj.SaveOnStageError.Wrap(err, "failed to delete from S3").
+			WithProperty(errorj.DBInfo, &types.ErrorPayload{
+				Bucket:    s3s.config.Bucket,
+				Statement: fmt.Sprintf("file: %s", key),
+			})
+	}
+
+	return nil
+}
+
+// ValidateWritePermission tries to create temporary file and remove it.
+// returns nil if file creation was successful.
+func (s3s *S3) ValidateWritePermission() error {
+	filename := fmt.Sprintf("test_%v", timestamp.NowUTC())
+
+	if err := s3s.UploadBytes(filename, []byte{}); err != nil {
+		return err
+	}
+
+	if err := s3s.DeleteObject(filename); err != nil {
+		logging.Warnf("Cannot remove object %q from S3: %v", filename, err)
+		// Suppressing error because we need to check only write permission
+	}
+
+	return nil
+}
+
+// Close marks the S3 client as closed. The AWS SDK client itself has no open connections to release.
+func (s3s *S3) Close() error {
+	s3s.closed.Store(true)
+	return nil
+}
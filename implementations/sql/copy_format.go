@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"fmt"
+	"github.com/jitsucom/bulker/implementations"
+)
+
+// Dialect identifies which CopyTables load-statement syntax FormatClause/EncryptionClause should
+// emit. It intentionally mirrors SQLAdapter.Type() so callers can pass that value straight through.
+type Dialect string
+
+const (
+	BigQueryDialect  Dialect = "bigquery"
+	RedshiftDialect  Dialect = "redshift"
+	SnowflakeDialect Dialect = "snowflake"
+)
+
+// FormatClause returns the FORMAT clause to append to a CopyTables load statement for a staged
+// file written in format, using the load-statement syntax for dialect (BigQuery LOAD DATA,
+// Redshift/Snowflake COPY INTO - the three syntaxes differ and aren't interchangeable).
+// CopyTables implementations should build their load command around this rather than hardcoding
+// a format.
+func FormatClause(dialect Dialect, format implementations.FileFormat) (string, error) {
+	switch dialect {
+	case BigQueryDialect:
+		switch format {
+		case implementations.JSON:
+			return "format = 'NEWLINE_DELIMITED_JSON'", nil
+		case implementations.CSV:
+			return "format = 'CSV'", nil
+		case implementations.Parquet:
+			return "format = 'PARQUET'", nil
+		case implementations.Avro:
+			return "format = 'AVRO'", nil
+		}
+	case RedshiftDialect:
+		switch format {
+		case implementations.JSON:
+			return "FORMAT AS JSON 'auto'", nil
+		case implementations.CSV:
+			return "FORMAT AS CSV", nil
+		case implementations.Parquet:
+			return "FORMAT AS PARQUET", nil
+		case implementations.Avro:
+			return "FORMAT AS AVRO 'auto'", nil
+		}
+	case SnowflakeDialect:
+		switch format {
+		case implementations.JSON:
+			return "FILE_FORMAT = (TYPE = JSON)", nil
+		case implementations.CSV:
+			return "FILE_FORMAT = (TYPE = CSV)", nil
+		case implementations.Parquet:
+			return "FILE_FORMAT = (TYPE = PARQUET)", nil
+		case implementations.Avro:
+			return "FILE_FORMAT = (TYPE = AVRO)", nil
+		}
+	default:
+		return "", fmt.Errorf("unsupported copy dialect: %s", dialect)
+	}
+	return "", fmt.Errorf("unsupported stage file format: %s", format)
+}
+
+// EncryptionClause returns the encryption clause to append to a CopyTables load statement when
+// the staged file is encrypted with a customer-managed KMS key, or "" when kmsKeyId is "" (i.e.
+// GetStageEncryptionKMSId() returned no key) or dialect doesn't take one:
+//   - Snowflake COPY INTO takes ENCRYPTION=(TYPE='AWS_SSE_KMS' KMS_KEY_ID='...').
+//   - BigQuery LOAD DATA has no encryption clause - CMEK is configured on the destination
+//     table/dataset, not the load statement - so this always returns "" for BigQueryDialect.
+//   - Redshift COPY also has no encryption clause - KMS-encrypted S3 objects are decrypted
+//     transparently via the COPY role's kms:Decrypt permission - so this always returns ""
+//     for RedshiftDialect.
+func EncryptionClause(dialect Dialect, kmsKeyId string) string {
+	if kmsKeyId == "" || dialect != SnowflakeDialect {
+		return ""
+	}
+	return fmt.Sprintf("ENCRYPTION=(TYPE='AWS_SSE_KMS' KMS_KEY_ID='%s')", kmsKeyId)
+}
@@ -2,6 +2,7 @@ package sql
 
 import (
 	"context"
+	"github.com/jitsucom/bulker/implementations"
 	"github.com/jitsucom/bulker/types"
 )
 
@@ -13,13 +14,28 @@ type SQLAdapter interface {
 	GetConfig() *DataSourceConfig
 	//GetTypesMapping return mapping from generic types to SQL types specific for this database
 	GetTypesMapping() map[types.DataType]string
+	//GetStageFileStorage returns the StageFileStorage used to stage batch files before loading them into
+	//the DWH (e.g. GoogleCloudStorage, S3, AzureBlob, LocalFS), or nil if this adapter loads rows directly.
+	GetStageFileStorage() implementations.StageFileStorage
+	//GetStageEncryptionKMSId returns the resolved KMS key id/URI used to encrypt staged files
+	//(CMEK for GCS, SSE-KMS for S3), or "" if staged files aren't encrypted with a customer-managed key.
+	//Adapters pass it to EncryptionClause, which emits an encryption clause for Snowflake COPY INTO only;
+	//BigQuery LOAD DATA and Redshift COPY get no encryption clause.
+	GetStageEncryptionKMSId() string
 	OpenTx(ctx context.Context) (*TxOrDBWrapper, error)
 	Insert(ctx context.Context, txOrDb TxOrDB, table *Table, merge bool, objects []types.Object) error
 	CreateDbSchema(ctx context.Context, txOrDb TxOrDB, dbSchemaName string) error
 	GetTableSchema(ctx context.Context, txOrDb TxOrDB, tableName string) (*Table, error)
 	CreateTable(ctx context.Context, txOrDb TxOrDB, schemaToCreate *Table) error
+	//CopyTables loads a staged file into targetTable. Implementations should build the load command's
+	//(e.g. BigQuery LOAD DATA, Redshift/Snowflake COPY INTO) FORMAT clause via
+	//FormatClause(dialect, GetStageFileStorage().Format()), passing the Dialect matching their own
+	//Type(), and append EncryptionClause(dialect, GetStageEncryptionKMSId()) when it's non-"".
 	CopyTables(ctx context.Context, txOrDb TxOrDB, targetTable *Table, sourceTable *Table, merge bool) error
-	PatchTableSchema(ctx context.Context, txOrDb TxOrDB, schemaToAdd *Table) error
+	//PatchTableSchema adds schemaToAdd.Columns (the new columns from a types.Table.TypedDiff) and,
+	//for every entry in schemaToAdd.ColumnsToWiden, executes the corresponding ALTER COLUMN ... TYPE ...
+	//statement in the same transaction as the additions.
+	PatchTableSchema(ctx context.Context, txOrDb TxOrDB, schemaToAdd *types.TypedDiff) error
 	TruncateTable(ctx context.Context, txOrDb TxOrDB, tableName string) error
 	Update(ctx context.Context, txOrDb TxOrDB, table *Table, object map[string]any, whereKey string, whereValue any) error
 	Delete(ctx context.Context, txOrDb TxOrDB, tableName string, deleteConditions *WhenConditions) error
@@ -0,0 +1,32 @@
+package sql
+
+import "github.com/jitsucom/bulker/implementations"
+
+// StagingConfig is embedded by SQLAdapter implementations that stage batch files in a
+// StageFileStorage before loading them into the DWH (BigQuery, Redshift, Snowflake, ...). Embedding
+// it gives an adapter GetStageFileStorage and GetStageEncryptionKMSId for free, backed by whatever
+// StageFileStorage/KMS id the adapter was constructed with, instead of each adapter hand-rolling
+// the same two getters.
+type StagingConfig struct {
+	StageFileStorage     implementations.StageFileStorage
+	StageEncryptionKMSId string
+}
+
+// NewStagingConfig builds a StagingConfig for storage, deriving StageEncryptionKMSId from it via
+// implementations.StageEncryptionKMSId rather than requiring the caller to look it up separately.
+func NewStagingConfig(storage implementations.StageFileStorage) StagingConfig {
+	return StagingConfig{
+		StageFileStorage:     storage,
+		StageEncryptionKMSId: implementations.StageEncryptionKMSId(storage),
+	}
+}
+
+// GetStageFileStorage implements SQLAdapter.GetStageFileStorage.
+func (c *StagingConfig) GetStageFileStorage() implementations.StageFileStorage {
+	return c.StageFileStorage
+}
+
+// GetStageEncryptionKMSId implements SQLAdapter.GetStageEncryptionKMSId.
+func (c *StagingConfig) GetStageEncryptionKMSId() string {
+	return c.StageEncryptionKMSId
+}
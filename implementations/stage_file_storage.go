@@ -0,0 +1,43 @@
+package implementations
+
+import "io"
+
+// StageFileStorage is a common interface for object storage backends used to stage
+// batch files before they are loaded into a destination DWH (BigQuery, Redshift, Snowflake, etc.)
+// GoogleCloudStorage, S3, AzureBlob and LocalFS all satisfy it so SQL adapters can be
+// configured with any of them interchangeably.
+type StageFileStorage interface {
+	// Upload writes fileReader under fileName to the storage backend.
+	Upload(fileName string, fileReader io.ReadSeeker) error
+	// UploadBytes writes fileBytes under fileName to the storage backend.
+	UploadBytes(fileName string, fileBytes []byte) error
+	// DeleteObject removes the object identified by key.
+	DeleteObject(key string) error
+	// ValidateWritePermission tries to create a temporary file and remove it to check write access.
+	ValidateWritePermission() error
+	// Format returns the FileFormat that staged files are written in.
+	Format() FileFormat
+	// Close releases any resources held by the storage backend.
+	Close() error
+}
+
+var (
+	_ StageFileStorage = (*GoogleCloudStorage)(nil)
+	_ StageFileStorage = (*S3)(nil)
+	_ StageFileStorage = (*AzureBlob)(nil)
+	_ StageFileStorage = (*LocalFS)(nil)
+)
+
+// StageEncryptionKMSId returns the customer-managed KMS key id/ARN staged files in storage are
+// encrypted with (GoogleCloudStorage.KMSKeyName, S3.KMSKeyId), or "" for backends that don't
+// support it (AzureBlob, LocalFS) or that aren't configured with one.
+func StageEncryptionKMSId(storage StageFileStorage) string {
+	switch s := storage.(type) {
+	case *GoogleCloudStorage:
+		return s.KMSKeyName()
+	case *S3:
+		return s.KMSKeyId()
+	default:
+		return ""
+	}
+}
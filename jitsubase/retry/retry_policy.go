@@ -0,0 +1,141 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes how an HTTP call should be retried: exponential backoff with jitter by
+// default, but falling back to the server's Retry-After header when present and RespectRetryAfter
+// is set - important for APIs (like Mixpanel's 429) that tell callers exactly how long to wait.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialDelay   time.Duration
+	MaxDelay       time.Duration
+	Multiplier     float64
+	JitterFraction float64
+	//RetryOn decides whether a completed (non-transport-error) response should be retried.
+	RetryOn func(status int, body string) bool
+	//RespectRetryAfter, when true, honors a Retry-After response header (delta-seconds or HTTP-date)
+	//instead of the computed backoff delay.
+	RespectRetryAfter bool
+}
+
+// DefaultRetryPolicy keeps the 5 attempts of the fixed retry table previously hardcoded in api_based
+// bulkers, but uses exponential backoff with jitter instead of its fixed delays and retries 429 in
+// addition to 500/502/503.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       5,
+		InitialDelay:      100 * time.Millisecond,
+		MaxDelay:          2 * time.Second,
+		Multiplier:        2,
+		JitterFraction:    0.2,
+		RespectRetryAfter: true,
+		RetryOn: func(status int, _ string) bool {
+			return status == 429 || status == 500 || status == 502 || status == 503
+		},
+	}
+}
+
+// Do calls attempt up to MaxAttempts times, reading and closing each response body so it can be
+// inspected by RetryOn. It returns the status code, the response body bytes, and an error - either
+// a transport error from the final attempt, or nil if the final attempt's status wasn't retryable
+// (retryable-but-exhausted attempts still return their last status/body with no error, matching the
+// previous fixed-table behavior where callers decide success/failure from the status code).
+// The context deadline is honored between attempts so callers can cancel stuck uploads.
+func (p RetryPolicy) Do(ctx context.Context, attempt func() (*http.Response, error)) (statusCode int, body []byte, err error) {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	for i := 0; i < maxAttempts; i++ {
+		var res *http.Response
+		res, err = attempt()
+		if err != nil {
+			if !p.sleep(ctx, i, nil) {
+				return 0, nil, ctx.Err()
+			}
+			continue
+		}
+
+		body, err = io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		statusCode = res.StatusCode
+		if err != nil {
+			return statusCode, body, err
+		}
+
+		if p.RetryOn == nil || !p.RetryOn(statusCode, string(body)) {
+			return statusCode, body, nil
+		}
+
+		if i == maxAttempts-1 {
+			return statusCode, body, nil
+		}
+		if !p.sleep(ctx, i, res) {
+			return statusCode, body, ctx.Err()
+		}
+	}
+	return statusCode, body, err
+}
+
+// sleep waits out this attempt's backoff (or Retry-After, if res carries one and RespectRetryAfter
+// is set), returning false if ctx was cancelled first.
+func (p RetryPolicy) sleep(ctx context.Context, attempt int, res *http.Response) bool {
+	delay := p.backoff(attempt)
+	if p.RespectRetryAfter && res != nil {
+		if retryAfter, ok := parseRetryAfter(res); ok {
+			delay = retryAfter
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial := p.InitialDelay
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	delay := time.Duration(float64(initial) * math.Pow(multiplier, float64(attempt)))
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.JitterFraction > 0 {
+		jitter := float64(delay) * p.JitterFraction
+		delay += time.Duration((rand.Float64()*2 - 1) * jitter)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return delay
+}
+
+func parseRetryAfter(res *http.Response) (time.Duration, bool) {
+	ra := res.Header.Get("Retry-After")
+	if ra == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(ra); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(ra); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
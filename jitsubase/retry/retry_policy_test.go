@@ -0,0 +1,136 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDoRetriesUntilSuccess(t *testing.T) {
+	attempts := 0
+	p := RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Millisecond,
+		Multiplier:   2,
+		RetryOn:      func(status int, _ string) bool { return status == 503 },
+	}
+
+	statusCode, _, err := p.Do(context.Background(), func() (*http.Response, error) {
+		attempts++
+		rec := httptest.NewRecorder()
+		rec.Code = http.StatusServiceUnavailable
+		if attempts == 3 {
+			rec.Code = http.StatusOK
+		}
+		return rec.Result(), nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("expected final status 200, got %d", statusCode)
+	}
+}
+
+func TestRetryPolicyDoStopsAtMaxAttempts(t *testing.T) {
+	attempts := 0
+	p := RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Millisecond,
+		Multiplier:   2,
+		RetryOn:      func(status int, _ string) bool { return status == 503 },
+	}
+
+	statusCode, _, err := p.Do(context.Background(), func() (*http.Response, error) {
+		attempts++
+		rec := httptest.NewRecorder()
+		rec.Code = http.StatusServiceUnavailable
+		return rec.Result(), nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected exactly MaxAttempts=3 attempts, got %d", attempts)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected last status 503 returned after exhausting retries, got %d", statusCode)
+	}
+}
+
+func TestRetryPolicyDoDoesNotRetryNonRetryableStatus(t *testing.T) {
+	attempts := 0
+	p := RetryPolicy{
+		MaxAttempts:  5,
+		InitialDelay: time.Millisecond,
+		RetryOn:      func(status int, _ string) bool { return status == 503 },
+	}
+
+	statusCode, _, err := p.Do(context.Background(), func() (*http.Response, error) {
+		attempts++
+		rec := httptest.NewRecorder()
+		rec.Code = http.StatusBadRequest
+		return rec.Result(), nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected 1 attempt for a non-retryable status, got %d", attempts)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", statusCode)
+	}
+}
+
+func TestRetryPolicyDoHonorsRetryAfterSeconds(t *testing.T) {
+	attempts := 0
+	var firstAttemptAt, secondAttemptAt time.Time
+	p := RetryPolicy{
+		MaxAttempts:       2,
+		InitialDelay:      time.Hour, // would time out the test if Retry-After weren't honored
+		RespectRetryAfter: true,
+		RetryOn:           func(status int, _ string) bool { return status == 429 },
+	}
+
+	_, _, err := p.Do(context.Background(), func() (*http.Response, error) {
+		attempts++
+		rec := httptest.NewRecorder()
+		if attempts == 1 {
+			firstAttemptAt = time.Now()
+			rec.Header().Set("Retry-After", "0")
+			rec.Code = http.StatusTooManyRequests
+		} else {
+			secondAttemptAt = time.Now()
+			rec.Code = http.StatusOK
+		}
+		return rec.Result(), nil
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+	if secondAttemptAt.Sub(firstAttemptAt) > 5*time.Second {
+		t.Fatalf("expected Retry-After: 0 to be honored instead of the 1h InitialDelay backoff, took %v", secondAttemptAt.Sub(firstAttemptAt))
+	}
+}
+
+func TestRetryPolicyDoTransportError(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond}
+	wantErr := errors.New("boom")
+
+	_, _, err := p.Do(context.Background(), func() (*http.Response, error) {
+		return nil, wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("expected transport error to propagate, got %v", err)
+	}
+}
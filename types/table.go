@@ -1,6 +1,7 @@
 package types
 
 import (
+	"fmt"
 	"github.com/jitsucom/bulker/base/utils"
 	"sort"
 )
@@ -81,7 +82,7 @@ func (t *Table) GetPKFieldsSet() utils.Set {
 // Return schema to add to current schema (for being equal) or empty if
 // 1) another one is empty
 // 2) all fields from another schema exist in current schema
-// NOTE: Diff method doesn't take types into account
+// NOTE: Diff method doesn't take types into account, see TypedDiff for type-aware diffing
 func (t *Table) Diff(another *Table) *Table {
 	diff := &Table{Schema: t.Schema, Name: t.Name, Columns: map[string]SQLColumn{}, PKFields: utils.Set{}}
 
@@ -123,3 +124,64 @@ func (t *Table) Diff(another *Table) *Table {
 func BuildConstraintName(schemaName string, tableName string) string {
 	return schemaName + "_" + tableName + "_pk"
 }
+
+// TypeCompatibility classifies how a column's new type relates to its current one for a given adapter.
+type TypeCompatibility int
+
+const (
+	// TypeUnchanged means the type is the same (or the adapter considers the difference immaterial).
+	TypeUnchanged TypeCompatibility = iota
+	// TypeWidening means the column can be safely ALTERed to the new type without data loss
+	// (int->bigint, varchar(16)->varchar(64), float->double, ...).
+	TypeWidening
+	// TypeIncompatible means the change would narrow or otherwise risk corrupting existing data.
+	TypeIncompatible
+)
+
+// TypeComparator compares a column's current SQL type against a candidate new type, using a
+// per-adapter SQLAdapter.GetTypesMapping() to know which generic types map to which concrete ones.
+type TypeComparator func(current SQLColumn, candidate SQLColumn) TypeCompatibility
+
+// ColumnWidening describes a column whose type should be widened via ALTER COLUMN ... TYPE ... .
+type ColumnWidening struct {
+	Name string
+	From SQLColumn
+	To   SQLColumn
+}
+
+// TypedDiff is the result of Table.TypedDiff: columns/PK changes from Diff, plus any column type
+// widenings that should be applied in the same transaction as the additions.
+type TypedDiff struct {
+	*Table
+	ColumnsToWiden []ColumnWidening
+}
+
+// TypedDiff is like Diff, but additionally compares the type of columns that exist in both schemas
+// using cmp. Widening type changes (e.g. int->bigint) are collected into ColumnsToWiden so
+// PatchTableSchema can emit ALTER COLUMN ... TYPE ... statements alongside the column additions.
+// Narrowing or otherwise incompatible type changes are returned as an error instead of being
+// silently dropped, since loading such data would fail or corrupt the destination table.
+func (t *Table) TypedDiff(another *Table, cmp TypeComparator) (*TypedDiff, error) {
+	typed := &TypedDiff{Table: t.Diff(another)}
+
+	if !another.Exists() || cmp == nil {
+		return typed, nil
+	}
+
+	for name, candidateColumn := range another.Columns {
+		currentColumn, ok := t.Columns[name]
+		if !ok {
+			//new column: already captured in typed.Columns by Diff
+			continue
+		}
+
+		switch cmp(currentColumn, candidateColumn) {
+		case TypeWidening:
+			typed.ColumnsToWiden = append(typed.ColumnsToWiden, ColumnWidening{Name: name, From: currentColumn, To: candidateColumn})
+		case TypeIncompatible:
+			return nil, fmt.Errorf("incompatible type change for column %q: %s -> %s", name, currentColumn.Type, candidateColumn.Type)
+		}
+	}
+
+	return typed, nil
+}
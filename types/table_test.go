@@ -0,0 +1,101 @@
+package types
+
+import "testing"
+
+func alwaysUnchanged(_ SQLColumn, _ SQLColumn) TypeCompatibility {
+	return TypeUnchanged
+}
+
+func TestTableTypedDiffAddsNewColumns(t *testing.T) {
+	current := &Table{Name: "events", Columns: Columns{"id": SQLColumn{Type: "int"}}}
+	another := &Table{Name: "events", Columns: Columns{
+		"id":    SQLColumn{Type: "int"},
+		"email": SQLColumn{Type: "varchar"},
+	}}
+
+	diff, err := current.TypedDiff(another, alwaysUnchanged)
+	if err != nil {
+		t.Fatalf("TypedDiff: %v", err)
+	}
+	if _, ok := diff.Columns["email"]; !ok || len(diff.Columns) != 1 {
+		t.Fatalf("expected only the new 'email' column in diff, got %v", diff.Columns)
+	}
+	if len(diff.ColumnsToWiden) != 0 {
+		t.Fatalf("expected no widenings, got %v", diff.ColumnsToWiden)
+	}
+}
+
+func TestTableTypedDiffCollectsWidenings(t *testing.T) {
+	current := &Table{Name: "events", Columns: Columns{"amount": SQLColumn{Type: "int"}}}
+	another := &Table{Name: "events", Columns: Columns{"amount": SQLColumn{Type: "bigint"}}}
+
+	cmp := func(current SQLColumn, candidate SQLColumn) TypeCompatibility {
+		if current.Type == "int" && candidate.Type == "bigint" {
+			return TypeWidening
+		}
+		return TypeUnchanged
+	}
+
+	diff, err := current.TypedDiff(another, cmp)
+	if err != nil {
+		t.Fatalf("TypedDiff: %v", err)
+	}
+	if len(diff.Columns) != 0 {
+		t.Fatalf("expected no new columns, got %v", diff.Columns)
+	}
+	if len(diff.ColumnsToWiden) != 1 {
+		t.Fatalf("expected 1 widening, got %v", diff.ColumnsToWiden)
+	}
+	widening := diff.ColumnsToWiden[0]
+	if widening.Name != "amount" || widening.From.Type != "int" || widening.To.Type != "bigint" {
+		t.Fatalf("unexpected widening: %+v", widening)
+	}
+}
+
+func TestTableTypedDiffRejectsIncompatibleChange(t *testing.T) {
+	current := &Table{Name: "events", Columns: Columns{"amount": SQLColumn{Type: "bigint"}}}
+	another := &Table{Name: "events", Columns: Columns{"amount": SQLColumn{Type: "int"}}}
+
+	cmp := func(current SQLColumn, candidate SQLColumn) TypeCompatibility {
+		if current.Type == "bigint" && candidate.Type == "int" {
+			return TypeIncompatible
+		}
+		return TypeUnchanged
+	}
+
+	diff, err := current.TypedDiff(another, cmp)
+	if err == nil {
+		t.Fatalf("expected error for narrowing type change, got diff %v", diff)
+	}
+}
+
+func TestTableTypedDiffNilComparatorFallsBackToDiff(t *testing.T) {
+	current := &Table{Name: "events", Columns: Columns{"id": SQLColumn{Type: "int"}}}
+	another := &Table{Name: "events", Columns: Columns{
+		"id":   SQLColumn{Type: "int"},
+		"name": SQLColumn{Type: "varchar"},
+	}}
+
+	diff, err := current.TypedDiff(another, nil)
+	if err != nil {
+		t.Fatalf("TypedDiff: %v", err)
+	}
+	if _, ok := diff.Columns["name"]; !ok {
+		t.Fatalf("expected 'name' column in diff, got %v", diff.Columns)
+	}
+	if len(diff.ColumnsToWiden) != 0 {
+		t.Fatalf("expected no widenings with nil comparator, got %v", diff.ColumnsToWiden)
+	}
+}
+
+func TestTableTypedDiffEmptyAnother(t *testing.T) {
+	current := &Table{Name: "events", Columns: Columns{"id": SQLColumn{Type: "int"}}}
+
+	diff, err := current.TypedDiff(&Table{}, alwaysUnchanged)
+	if err != nil {
+		t.Fatalf("TypedDiff: %v", err)
+	}
+	if diff.Exists() {
+		t.Fatalf("expected empty diff when another table doesn't exist, got %v", diff.Table)
+	}
+}